@@ -0,0 +1,87 @@
+package db
+
+import (
+	"fmt"
+	"io"
+
+	ldbiterator "github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Engine identifies the key-value storage engine which backs a BaseDB.
+type Engine string
+
+const (
+	// LevelDBEngine stores data in goleveldb. It is the default engine.
+	LevelDBEngine Engine = "leveldb"
+
+	// PebbleEngine stores data in CockroachDB's Pebble.
+	PebbleEngine Engine = "pebble"
+
+	// MemoryEngine keeps all data in memory. Path is ignored and all data
+	// is discarded on Close. It is intended for unit tests.
+	MemoryEngine Engine = "memory"
+)
+
+// leveldbStatsProperty is the Stat property understood by every engine.
+const leveldbStatsProperty = "leveldb.stats"
+
+// ParseEngine returns the Engine with the given name.
+// An empty name selects the LevelDBEngine.
+func ParseEngine(name string) (Engine, error) {
+	switch Engine(name) {
+	case "", LevelDBEngine:
+		return LevelDBEngine, nil
+	case PebbleEngine:
+		return PebbleEngine, nil
+	case MemoryEngine:
+		return MemoryEngine, nil
+	default:
+		return "", fmt.Errorf("unsupported db engine: %s", name)
+	}
+}
+
+// backend is the key-value store used by baseDB. Every Engine has its own implementation.
+// Get returns leveldb.ErrNotFound for missing keys regardless of the engine.
+type backend interface {
+	KeyValueWriter
+
+	io.Closer
+
+	// Has returns true if the backend does contain the given key.
+	Has(key []byte) (bool, error)
+
+	// Get gets the value for the given key.
+	Get(key []byte) ([]byte, error)
+
+	// NewBatch creates a write-only batch which is applied atomically by Write.
+	NewBatch() Batch
+
+	// NewIterator creates an iterator over given key range. A nil range iterates everything.
+	NewIterator(r *util.Range) ldbiterator.Iterator
+
+	// Stat returns a particular internal stat of the backend.
+	Stat(property string) (string, error)
+
+	// Compact flattens the underlying data store for the given key range.
+	Compact(start []byte, limit []byte) error
+}
+
+// openBackend opens the backend for given engine at given path.
+func openBackend(path string, engine Engine, readOnly bool) (backend, error) {
+	switch engine {
+	case "", LevelDBEngine:
+		var o *opt.Options
+		if readOnly {
+			o = &opt.Options{ReadOnly: true}
+		}
+		return openLevelDBBackend(path, o, nil, nil)
+	case PebbleEngine:
+		return openPebbleBackend(path, readOnly)
+	case MemoryEngine:
+		return newMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("unsupported db engine: %s", engine)
+	}
+}
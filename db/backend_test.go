@@ -0,0 +1,130 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var testEngines = []Engine{LevelDBEngine, PebbleEngine, MemoryEngine}
+
+func TestParseEngine(t *testing.T) {
+	for _, name := range []string{"", "leveldb", "pebble", "memory"} {
+		if _, err := ParseEngine(name); err != nil {
+			t.Fatalf("engine %q must be supported; %v", name, err)
+		}
+	}
+
+	if _, err := ParseEngine("rocksdb"); err == nil {
+		t.Fatal("unsupported engine must return an error")
+	}
+}
+
+func TestBaseDB_Engines(t *testing.T) {
+	for _, engine := range testEngines {
+		t.Run(string(engine), func(t *testing.T) {
+			db, err := NewBaseDBWithEngine(t.TempDir()+"test-db", engine)
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.Put([]byte("ab1"), []byte{1}))
+			require.NoError(t, db.Put([]byte("ab2"), []byte{2}))
+			require.NoError(t, db.Put([]byte("ac3"), []byte{3}))
+
+			has, err := db.Has([]byte("ab1"))
+			require.NoError(t, err)
+			require.True(t, has)
+
+			value, err := db.Get([]byte("ab2"))
+			require.NoError(t, err)
+			require.Equal(t, []byte{2}, value)
+
+			require.NoError(t, db.Delete([]byte("ab2")))
+			_, err = db.Get([]byte("ab2"))
+			if !errors.Is(err, leveldb.ErrNotFound) {
+				t.Fatalf("unexpected err, got: %v, want: %v", err, leveldb.ErrNotFound)
+			}
+			has, err = db.Has([]byte("ab2"))
+			require.NoError(t, err)
+			require.False(t, has)
+
+			_, err = db.Stat(leveldbStatsProperty)
+			require.NoError(t, err)
+			require.NoError(t, db.Compact(nil, nil))
+		})
+	}
+}
+
+func TestBaseDB_EnginesIterator(t *testing.T) {
+	for _, engine := range testEngines {
+		t.Run(string(engine), func(t *testing.T) {
+			db, err := NewBaseDBWithEngine(t.TempDir()+"test-db", engine)
+			require.NoError(t, err)
+			defer db.Close()
+
+			for _, key := range []string{"a1", "b1", "b2", "b3", "c1"} {
+				require.NoError(t, db.Put([]byte(key), []byte(key)))
+			}
+
+			iter := db.NewIterator([]byte("b"), []byte("2"))
+			var got []string
+			for iter.Next() {
+				if !bytes.Equal(iter.Key(), iter.Value()) {
+					t.Fatalf("unexpected value %s for key %s", iter.Value(), iter.Key())
+				}
+				got = append(got, string(iter.Key()))
+			}
+			iter.Release()
+			require.NoError(t, iter.Error())
+			require.Equal(t, []string{"b2", "b3"}, got)
+		})
+	}
+}
+
+func TestBaseDB_EnginesBatch(t *testing.T) {
+	for _, engine := range testEngines {
+		t.Run(string(engine), func(t *testing.T) {
+			db, err := NewBaseDBWithEngine(t.TempDir()+"test-db", engine)
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.Put([]byte("c"), []byte{3}))
+
+			batch := db.NewBatch()
+			require.NoError(t, batch.Put([]byte("a"), []byte{1}))
+			require.NoError(t, batch.Put([]byte("b"), []byte{2}))
+			require.NoError(t, batch.Delete([]byte("c")))
+			require.Equal(t, 3, batch.ValueSize())
+
+			replayed, err := NewBaseDBWithEngine(t.TempDir()+"test-replay-db", MemoryEngine)
+			require.NoError(t, err)
+			require.NoError(t, batch.Replay(replayed))
+			has, err := replayed.Has([]byte("b"))
+			require.NoError(t, err)
+			require.True(t, has)
+
+			require.NoError(t, batch.Write())
+			value, err := db.Get([]byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, []byte{1}, value)
+			has, err = db.Has([]byte("c"))
+			require.NoError(t, err)
+			require.False(t, has)
+
+			batch.Reset()
+			require.Equal(t, 0, batch.ValueSize())
+		})
+	}
+}
+
+// forEachEngine runs test as a subtest for every engine in testEngines.
+func forEachEngine(t *testing.T, test func(t *testing.T, engine Engine)) {
+	for _, engine := range testEngines {
+		t.Run(string(engine), func(t *testing.T) {
+			test(t, engine)
+		})
+	}
+}
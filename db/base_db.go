@@ -8,7 +8,6 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 
-	"github.com/syndtr/goleveldb/leveldb"
 	ldbiterator "github.com/syndtr/goleveldb/leveldb/iterator"
 )
 
@@ -45,6 +44,7 @@ type BaseDB interface {
 	NewIterator(prefix []byte, start []byte) ldbiterator.Iterator
 
 	// Stat returns a particular internal stat of the database.
+	// The "leveldb.stats" property is supported by every Engine.
 	Stat(property string) (string, error)
 
 	// Compact flattens the underlying data store for the given key range. In essence,
@@ -66,7 +66,7 @@ type BaseDB interface {
 	Close() error
 
 	// getBackend returns the database backend.
-	getBackend() *leveldb.DB
+	getBackend() backend
 }
 
 // NewDefaultBaseDB creates new instance of BaseDB with default options.
@@ -80,6 +80,11 @@ func NewBaseDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.ReadOp
 	return newBaseDB(path, o, wo, ro)
 }
 
+// NewBaseDBWithEngine creates new instance of BaseDB stored in given Engine with default options.
+func NewBaseDBWithEngine(path string, engine Engine) (BaseDB, error) {
+	return newBaseDBWithEngine(path, engine, false)
+}
+
 func MakeDefaultBaseDBFromBaseDB(db BaseDB) BaseDB {
 	return &baseDB{backend: db.getBackend()}
 }
@@ -89,6 +94,11 @@ func NewReadOnlyBaseDB(path string) (BaseDB, error) {
 	return newBaseDB(path, &opt.Options{ReadOnly: true}, nil, nil)
 }
 
+// NewReadOnlyBaseDBWithEngine creates a new instance of read-only BaseDB stored in given Engine.
+func NewReadOnlyBaseDBWithEngine(path string, engine Engine) (BaseDB, error) {
+	return newBaseDBWithEngine(path, engine, true)
+}
+
 // OpenBaseDB opens existing database. If it does not exists error is returned instead.
 func OpenBaseDB(path string) (BaseDB, error) {
 	_, err := os.Stat(path)
@@ -100,34 +110,36 @@ func OpenBaseDB(path string) (BaseDB, error) {
 }
 
 func newBaseDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.ReadOptions) (*baseDB, error) {
-	b, err := leveldb.OpenFile(path, o)
+	b, err := openLevelDBBackend(path, o, wo, ro)
+	if err != nil {
+		return nil, err
+	}
+	return &baseDB{backend: b}, nil
+}
+
+func newBaseDBWithEngine(path string, engine Engine, readOnly bool) (*baseDB, error) {
+	b, err := openBackend(path, engine, readOnly)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open leveldb; %w", err)
+		return nil, err
 	}
-	return &baseDB{
-		backend: b,
-		wo:      wo,
-		ro:      ro,
-	}, nil
+	return &baseDB{backend: b}, nil
 }
 
 // baseDB implements method needed by all three types of DBs.
 type baseDB struct {
-	backend *leveldb.DB
-	wo      *opt.WriteOptions
-	ro      *opt.ReadOptions
+	backend backend
 }
 
-func (db *baseDB) getBackend() *leveldb.DB {
+func (db *baseDB) getBackend() backend {
 	return db.backend
 }
 
 func (db *baseDB) Put(key []byte, value []byte) error {
-	return db.backend.Put(key, value, db.wo)
+	return db.backend.Put(key, value)
 }
 
 func (db *baseDB) Delete(key []byte) error {
-	return db.backend.Delete(key, db.wo)
+	return db.backend.Delete(key)
 }
 
 func (db *baseDB) Close() error {
@@ -135,15 +147,15 @@ func (db *baseDB) Close() error {
 }
 
 func (db *baseDB) Has(key []byte) (bool, error) {
-	return db.backend.Has(key, db.ro)
+	return db.backend.Has(key)
 }
 
 func (db *baseDB) Get(key []byte) ([]byte, error) {
-	return db.backend.Get(key, db.ro)
+	return db.backend.Get(key)
 }
 
 func (db *baseDB) NewBatch() Batch {
-	return newBatch(db.backend)
+	return db.backend.NewBatch()
 }
 
 // newIterator returns iterator which iterates over values depending on the prefix.
@@ -151,15 +163,15 @@ func (db *baseDB) NewBatch() Batch {
 func (db *baseDB) NewIterator(prefix []byte, start []byte) ldbiterator.Iterator {
 	r := util.BytesPrefix(prefix)
 	r.Start = append(r.Start, start...)
-	return db.backend.NewIterator(r, db.ro)
+	return db.backend.NewIterator(r)
 }
 
 func (db *baseDB) Stat(property string) (string, error) {
-	return db.backend.GetProperty(property)
+	return db.backend.Stat(property)
 }
 
 func (db *baseDB) Compact(start []byte, limit []byte) error {
-	return db.backend.CompactRange(util.Range{Start: start, Limit: limit})
+	return db.backend.Compact(start, limit)
 }
 
 func (db *baseDB) hasKeyValuesFor(prefix []byte, start []byte) bool {
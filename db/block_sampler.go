@@ -0,0 +1,174 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BlockSampler reports whether a block is part of a sample. Samplers are
+// stateless, hence a block is selected independently of the order in which
+// blocks are visited and a sample is reproducible across runs.
+type BlockSampler func(block uint64) bool
+
+// EveryNthBlock returns a sampler selecting blocks divisible by n.
+func EveryNthBlock(n uint64) BlockSampler {
+	if n == 0 {
+		n = 1
+	}
+	return func(block uint64) bool {
+		return block%n == 0
+	}
+}
+
+// RandomBlocks returns a sampler selecting given fraction of blocks at random.
+// The same seed always selects the same blocks.
+func RandomBlocks(fraction float64, seed int64) BlockSampler {
+	return func(block uint64) bool {
+		return sampleFloat(block, seed) < fraction
+	}
+}
+
+// StratifiedBlocks returns a sampler splitting blocks into consecutive strata
+// of stratumSize blocks and selecting perStratum random blocks of each stratum.
+// The same seed always selects the same blocks.
+func StratifiedBlocks(stratumSize uint64, perStratum int, seed int64) BlockSampler {
+	if stratumSize == 0 {
+		stratumSize = 1
+	}
+	if perStratum <= 0 {
+		return func(uint64) bool { return false }
+	}
+	if uint64(perStratum) >= stratumSize {
+		return func(uint64) bool { return true }
+	}
+	s := &stratifiedSampler{stratumSize: stratumSize, perStratum: perStratum, seed: seed}
+	return s.sample
+}
+
+// maxCachedStrata is the number of strata whose selected offsets are cached. Several
+// strata are cached as the producer of a SubstateTaskPool samples blocks ahead of its
+// in-order watermark loop.
+const maxCachedStrata = 4
+
+// stratifiedSampler caches the offsets selected in the most recent strata; the offsets
+// of a stratum only depend on the seed, hence the cache does not change the sample.
+type stratifiedSampler struct {
+	stratumSize uint64
+	perStratum  int
+	seed        int64
+
+	lock     sync.RWMutex
+	selected map[uint64]map[uint64]struct{} // stratum -> selected offsets
+}
+
+func (s *stratifiedSampler) sample(block uint64) bool {
+	stratum := block / s.stratumSize
+	offset := block % s.stratumSize
+
+	s.lock.RLock()
+	selected, ok := s.selected[stratum]
+	s.lock.RUnlock()
+	if !ok {
+		selected = s.draw(stratum)
+		s.cache(stratum, selected)
+	}
+	_, ok = selected[offset]
+	return ok
+}
+
+// cache stores the selected offsets of given stratum evicting the lowest stratum if the cache is full.
+func (s *stratifiedSampler) cache(stratum uint64, selected map[uint64]struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.selected == nil {
+		s.selected = make(map[uint64]map[uint64]struct{}, maxCachedStrata)
+	}
+	if _, ok := s.selected[stratum]; !ok && len(s.selected) >= maxCachedStrata {
+		lowest := uint64(math.MaxUint64)
+		for cached := range s.selected {
+			lowest = min(lowest, cached)
+		}
+		delete(s.selected, lowest)
+	}
+	s.selected[stratum] = selected
+}
+
+// draw returns perStratum distinct offsets of given stratum using Floyd's algorithm.
+func (s *stratifiedSampler) draw(stratum uint64) map[uint64]struct{} {
+	selected := make(map[uint64]struct{}, s.perStratum)
+	stratumSeed := int64(sampleHash(stratum, s.seed))
+	for j := s.stratumSize - uint64(s.perStratum); j < s.stratumSize; j++ {
+		t := sampleHash(j, stratumSeed) % (j + 1)
+		if _, ok := selected[t]; ok {
+			t = j
+		}
+		selected[t] = struct{}{}
+	}
+	return selected
+}
+
+// sampleHash mixes block and seed into a uniformly distributed value.
+func sampleHash(block uint64, seed int64) uint64 {
+	return splitMix64(block ^ splitMix64(uint64(seed)))
+}
+
+// splitMix64 is the finalizer of the SplitMix64 generator.
+func splitMix64(z uint64) uint64 {
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// sampleFloat returns a uniformly distributed value in [0, 1) for given block and seed.
+func sampleFloat(block uint64, seed int64) float64 {
+	return float64(sampleHash(block, seed)>>11) / (1 << 53)
+}
+
+// ParseBlockSampler parses a sampler specification:
+//
+//	every=<n>                   every nth block
+//	random=<fraction>           random fraction of blocks, e.g. random=0.01
+//	stratified=<size>/<count>   count random blocks out of every size consecutive blocks
+//
+// Random samplers use given seed.
+func ParseBlockSampler(spec string, seed int64) (BlockSampler, error) {
+	kind, arg, ok := strings.Cut(spec, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid sample %q; expected <kind>=<argument>", spec)
+	}
+
+	switch kind {
+	case "every":
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid sample %q; expected positive block interval", spec)
+		}
+		return EveryNthBlock(n), nil
+
+	case "random":
+		fraction, err := strconv.ParseFloat(arg, 64)
+		if err != nil || math.IsNaN(fraction) || fraction <= 0 || fraction > 1 {
+			return nil, fmt.Errorf("invalid sample %q; expected fraction in (0, 1]", spec)
+		}
+		return RandomBlocks(fraction, seed), nil
+
+	case "stratified":
+		sizeArg, countArg, _ := strings.Cut(arg, "/")
+		size, err := strconv.ParseUint(sizeArg, 10, 64)
+		if err != nil || size == 0 {
+			return nil, fmt.Errorf("invalid sample %q; expected positive stratum size", spec)
+		}
+		count, err := strconv.Atoi(countArg)
+		if err != nil || count <= 0 || uint64(count) > size {
+			return nil, fmt.Errorf("invalid sample %q; expected between 1 and %v blocks per stratum", spec, size)
+		}
+		return StratifiedBlocks(size, count, seed), nil
+
+	default:
+		return nil, fmt.Errorf("invalid sample %q; unknown kind %q", spec, kind)
+	}
+}
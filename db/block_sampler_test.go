@@ -0,0 +1,117 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func countSampled(sampler BlockSampler, first, last uint64) int {
+	count := 0
+	for block := first; block <= last; block++ {
+		if sampler(block) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestBlockSampler_EveryNthBlock(t *testing.T) {
+	sampler := EveryNthBlock(10)
+	require.True(t, sampler(0))
+	require.False(t, sampler(5))
+	require.True(t, sampler(20))
+	require.Equal(t, 100, countSampled(sampler, 1, 1000))
+	require.Equal(t, 1000, countSampled(EveryNthBlock(0), 1, 1000))
+}
+
+func TestBlockSampler_RandomBlocks(t *testing.T) {
+	sampler := RandomBlocks(0.1, 42)
+	count := countSampled(sampler, 1, 100_000)
+	require.InDelta(t, 10_000, count, 500)
+
+	// same seed selects same blocks, other seed selects others
+	same := RandomBlocks(0.1, 42)
+	other := RandomBlocks(0.1, 43)
+	differs := false
+	for block := uint64(1); block <= 1000; block++ {
+		require.Equal(t, sampler(block), same(block))
+		differs = differs || sampler(block) != other(block)
+	}
+	require.True(t, differs)
+
+	require.Equal(t, 0, countSampled(RandomBlocks(0, 1), 1, 1000))
+	require.Equal(t, 1000, countSampled(RandomBlocks(1, 1), 1, 1000))
+}
+
+func TestBlockSampler_StratifiedBlocks(t *testing.T) {
+	sampler := StratifiedBlocks(100, 3, 7)
+	for stratum := uint64(0); stratum < 50; stratum++ {
+		require.Equal(t, 3, countSampled(sampler, stratum*100, stratum*100+99), "stratum %d", stratum)
+	}
+
+	same := StratifiedBlocks(100, 3, 7)
+	for block := uint64(0); block < 1000; block++ {
+		require.Equal(t, sampler(block), same(block))
+	}
+
+	// strata visited out of order select the same blocks
+	for block := uint64(999); block >= 7; block -= 7 {
+		same(block % 100 * 10)
+		require.Equal(t, sampler(block), same(block))
+	}
+
+	require.Equal(t, 100, countSampled(StratifiedBlocks(10, 10, 1), 0, 99))
+	require.Equal(t, 0, countSampled(StratifiedBlocks(10, 0, 1), 0, 99))
+}
+
+func TestBlockSampler_StratifiedBlocksCachesRecentStrata(t *testing.T) {
+	s := &stratifiedSampler{stratumSize: 10, perStratum: 2, seed: 3}
+
+	// alternating strata, as sampled by the producer and the watermark loop of a pool, are both cached
+	for block := uint64(5); block < 15; block++ {
+		s.sample(block)
+		s.sample(block + 10)
+	}
+	require.Len(t, s.selected, 3)
+
+	for block := uint64(30); block < 60; block++ {
+		s.sample(block)
+	}
+	require.Len(t, s.selected, maxCachedStrata)
+	for stratum := uint64(2); stratum <= 5; stratum++ {
+		require.Contains(t, s.selected, stratum)
+	}
+}
+
+func TestBlockSampler_ParseBlockSampler(t *testing.T) {
+	sampler, err := ParseBlockSampler("every=5", 0)
+	require.NoError(t, err)
+	require.Equal(t, 20, countSampled(sampler, 1, 100))
+
+	sampler, err = ParseBlockSampler("random=0.5", 3)
+	require.NoError(t, err)
+	require.InDelta(t, 5000, countSampled(sampler, 1, 10_000), 300)
+
+	sampler, err = ParseBlockSampler("stratified=1000/10", 3)
+	require.NoError(t, err)
+	require.Equal(t, 100, countSampled(sampler, 0, 9999))
+
+	for _, spec := range []string{
+		"",
+		"every",
+		"every=0",
+		"every=-1",
+		"random=0",
+		"random=1.5",
+		"random=abc",
+		"stratified=100",
+		"stratified=0/1",
+		"stratified=10/11",
+		"stratified=10/0",
+		"unknown=1",
+	} {
+		_, err := ParseBlockSampler(spec, 0)
+		require.Error(t, err, spec)
+	}
+}
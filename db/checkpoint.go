@@ -0,0 +1,187 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	CheckpointPrefix = MetadataPrefix + "cp" // CheckpointPrefix + name -> first, last and last completed block (3x 64-bit)
+
+	defaultCheckpointInterval = 10 * time.Second
+)
+
+// ErrCheckpointMismatch is returned when resuming a SubstateTaskPool from a checkpoint
+// saved by a pool of another block range.
+var ErrCheckpointMismatch = errors.New("checkpoint does not match block range")
+
+// Checkpoint is the progress of a SubstateTaskPool executing blocks First to Last.
+type Checkpoint struct {
+	First uint64 // first block of the pool
+	Last  uint64 // last block of the pool
+	Block uint64 // last block completed in order
+}
+
+// Checkpointer persists the progress of a SubstateTaskPool, so an interrupted
+// run can be resumed after the last block completed in order.
+type Checkpointer interface {
+	// LoadCheckpoint returns the last saved checkpoint. If there is no checkpoint yet, ok is false.
+	LoadCheckpoint() (checkpoint Checkpoint, ok bool, err error)
+
+	// SaveCheckpoint saves given checkpoint replacing the previous one.
+	SaveCheckpoint(checkpoint Checkpoint) error
+}
+
+// NewFileCheckpointer returns a Checkpointer which stores the checkpoint in the given
+// file as a line of its first, last and last completed block.
+func NewFileCheckpointer(path string) Checkpointer {
+	return &fileCheckpointer{path: path}
+}
+
+type fileCheckpointer struct {
+	path string
+}
+
+func (c *fileCheckpointer) LoadCheckpoint() (Checkpoint, bool, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("cannot read checkpoint %v; %w", c.path, err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return Checkpoint{}, false, fmt.Errorf("invalid checkpoint %v; expected first, last and completed block, got %q", c.path, strings.TrimSpace(string(data)))
+	}
+	var blocks [3]uint64
+	for i, field := range fields {
+		if blocks[i], err = strconv.ParseUint(field, 10, 64); err != nil {
+			return Checkpoint{}, false, fmt.Errorf("invalid checkpoint %v; %w", c.path, err)
+		}
+	}
+	return Checkpoint{First: blocks[0], Last: blocks[1], Block: blocks[2]}, true, nil
+}
+
+// SaveCheckpoint writes into a temporary file first, so a crash never leaves a truncated checkpoint behind.
+func (c *fileCheckpointer) SaveCheckpoint(checkpoint Checkpoint) error {
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create checkpoint %v; %w", c.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = fmt.Fprintf(tmp, "%d %d %d\n", checkpoint.First, checkpoint.Last, checkpoint.Block); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write checkpoint %v; %w", c.path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write checkpoint %v; %w", c.path, err)
+	}
+	if err = os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("cannot write checkpoint %v; %w", c.path, err)
+	}
+	return nil
+}
+
+// NewDBCheckpointer returns a Checkpointer which stores the checkpoint
+// in db under the metadata key CheckpointPrefix + name.
+func NewDBCheckpointer(db BaseDB, name string) Checkpointer {
+	return &dbCheckpointer{db: db, key: CheckpointDBKey(name)}
+}
+
+type dbCheckpointer struct {
+	db  BaseDB
+	key []byte
+}
+
+func (c *dbCheckpointer) LoadCheckpoint() (Checkpoint, bool, error) {
+	data, err := c.db.Get(c.key)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("cannot get checkpoint %s; %w", c.key, err)
+	}
+	if len(data) != checkpointLength {
+		return Checkpoint{}, false, fmt.Errorf("invalid length of checkpoint %s: %v", c.key, len(data))
+	}
+	return Checkpoint{
+		First: binary.BigEndian.Uint64(data[0:8]),
+		Last:  binary.BigEndian.Uint64(data[8:16]),
+		Block: binary.BigEndian.Uint64(data[16:24]),
+	}, true, nil
+}
+
+func (c *dbCheckpointer) SaveCheckpoint(checkpoint Checkpoint) error {
+	data := make([]byte, 0, checkpointLength)
+	data = binary.BigEndian.AppendUint64(data, checkpoint.First)
+	data = binary.BigEndian.AppendUint64(data, checkpoint.Last)
+	data = binary.BigEndian.AppendUint64(data, checkpoint.Block)
+	if err := c.db.Put(c.key, data); err != nil {
+		return fmt.Errorf("cannot put checkpoint %s; %w", c.key, err)
+	}
+	return nil
+}
+
+// checkpointLength is the length of a checkpoint stored by dbCheckpointer.
+const checkpointLength = 3 * 8
+
+// CheckpointDBKey returns CheckpointPrefix with appended name creating key used in baseDB for checkpoints.
+func CheckpointDBKey(name string) []byte {
+	return []byte(CheckpointPrefix + name)
+}
+
+// checkpointWriter saves the watermark of a SubstateTaskPool at most once per interval.
+type checkpointWriter struct {
+	checkpointer Checkpointer
+	interval     time.Duration
+	lastSave     time.Time
+	checkpoint   Checkpoint
+	dirty        bool
+}
+
+func newCheckpointWriter(checkpointer Checkpointer, interval time.Duration, first, last uint64) *checkpointWriter {
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	return &checkpointWriter{
+		checkpointer: checkpointer,
+		interval:     interval,
+		lastSave:     time.Now(),
+		checkpoint:   Checkpoint{First: first, Last: last},
+	}
+}
+
+// update records block as completed and saves it if the interval has elapsed.
+func (w *checkpointWriter) update(block uint64) error {
+	if w == nil {
+		return nil
+	}
+	w.checkpoint.Block, w.dirty = block, true
+	if time.Since(w.lastSave) < w.interval {
+		return nil
+	}
+	return w.flush()
+}
+
+// flush saves the last completed block if it was not saved yet.
+func (w *checkpointWriter) flush() error {
+	if w == nil || !w.dirty {
+		return nil
+	}
+	if err := w.checkpointer.SaveCheckpoint(w.checkpoint); err != nil {
+		return err
+	}
+	w.lastSave, w.dirty = time.Now(), false
+	return nil
+}
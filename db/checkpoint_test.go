@@ -0,0 +1,161 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xsoniclabs/substate/substate"
+)
+
+func TestCheckpoint_File(t *testing.T) {
+	c := NewFileCheckpointer(filepath.Join(t.TempDir(), "checkpoint"))
+
+	_, ok, err := c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, c.SaveCheckpoint(Checkpoint{First: 1, Last: 30, Block: 10}))
+	require.NoError(t, c.SaveCheckpoint(Checkpoint{First: 1, Last: 30, Block: 20}))
+
+	cp, ok, err := c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Checkpoint{First: 1, Last: 30, Block: 20}, cp)
+}
+
+func TestCheckpoint_FileRejectsInvalidContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	c := NewFileCheckpointer(path)
+
+	// checkpoint of an older version without block range
+	require.NoError(t, os.WriteFile(path, []byte("20\n"), 0600))
+	_, _, err := c.LoadCheckpoint()
+	require.ErrorContains(t, err, "expected first, last and completed block")
+
+	require.NoError(t, os.WriteFile(path, []byte("1 30 x\n"), 0600))
+	_, _, err = c.LoadCheckpoint()
+	require.ErrorContains(t, err, "invalid checkpoint")
+}
+
+func TestCheckpoint_DB(t *testing.T) {
+	db, err := NewBaseDBWithEngine(t.TempDir()+"test-db", MemoryEngine)
+	require.NoError(t, err)
+
+	c := NewDBCheckpointer(db, "test")
+
+	_, ok, err := c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, c.SaveCheckpoint(Checkpoint{First: 5, Last: 15, Block: 10}))
+
+	cp, ok, err := c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Checkpoint{First: 5, Last: 15, Block: 10}, cp)
+
+	// checkpoints of different names are independent
+	_, ok, err = NewDBCheckpointer(db, "other").LoadCheckpoint()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestSubstateTaskPool_ExecuteResumesFromCheckpoint(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewFileCheckpointer(filepath.Join(t.TempDir(), "checkpoint"))
+
+	var lock sync.Mutex
+	var executed []uint64
+	failAt := uint64(15)
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		BlockFunc: func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error {
+			if block == failAt {
+				return errors.New("test error")
+			}
+			lock.Lock()
+			executed = append(executed, block)
+			lock.Unlock()
+			return nil
+		},
+
+		First: 10,
+		Last:  20,
+
+		Workers:    1,
+		Checkpoint: c,
+		DB:         db,
+	}
+
+	require.Error(t, stPool.Execute())
+
+	cp, ok, err := c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Checkpoint{First: 10, Last: 20, Block: failAt - 1}, cp)
+
+	// rerun without failure continues after the checkpoint
+	failAt = 0
+	executed = nil
+	require.NoError(t, stPool.Execute())
+	require.Equal(t, []uint64{15, 16, 17, 18, 19, 20}, executed)
+
+	cp, _, err = c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), cp.Block)
+
+	// nothing left to execute
+	executed = nil
+	require.NoError(t, stPool.Execute())
+	require.Empty(t, executed)
+}
+
+func TestSubstateTaskPool_ExecuteRejectsCheckpointOfOtherRange(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a completed run of another range must not skip the blocks of this one
+	c := NewFileCheckpointer(filepath.Join(t.TempDir(), "checkpoint"))
+	require.NoError(t, c.SaveCheckpoint(Checkpoint{First: 1, Last: 100, Block: 100}))
+
+	executed := 0
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		BlockFunc: func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error {
+			executed++
+			return nil
+		},
+
+		First: 10,
+		Last:  20,
+
+		Workers:    1,
+		Checkpoint: c,
+		DB:         db,
+	}
+
+	err = stPool.Execute()
+	require.ErrorIs(t, err, ErrCheckpointMismatch)
+	require.ErrorContains(t, err, "checkpoint of blocks 1-100 cannot resume blocks 10-20")
+	require.Zero(t, executed)
+
+	// the checkpoint is left untouched
+	cp, _, err := c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, Checkpoint{First: 1, Last: 100, Block: 100}, cp)
+}
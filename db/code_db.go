@@ -40,6 +40,11 @@ func NewCodeDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.ReadOp
 	return newCodeDB(path, o, wo, ro)
 }
 
+// NewCodeDBWithEngine creates new instance of CodeDB stored in given Engine with default options.
+func NewCodeDBWithEngine(path string, engine Engine) (CodeDB, error) {
+	return newCodeDBWithEngine(path, engine, false)
+}
+
 func MakeDefaultCodeDBFromBaseDB(db BaseDB) CodeDB {
 	return &codeDB{&baseDB{backend: db.getBackend()}}
 }
@@ -49,6 +54,11 @@ func NewReadOnlyCodeDB(path string) (CodeDB, error) {
 	return newCodeDB(path, &opt.Options{ReadOnly: true}, nil, nil)
 }
 
+// NewReadOnlyCodeDBWithEngine creates a new instance of read-only CodeDB stored in given Engine.
+func NewReadOnlyCodeDBWithEngine(path string, engine Engine) (CodeDB, error) {
+	return newCodeDBWithEngine(path, engine, true)
+}
+
 func newCodeDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.ReadOptions) (*codeDB, error) {
 	base, err := newBaseDB(path, o, wo, ro)
 	if err != nil {
@@ -57,6 +67,14 @@ func newCodeDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.ReadOp
 	return &codeDB{base}, nil
 }
 
+func newCodeDBWithEngine(path string, engine Engine, readOnly bool) (*codeDB, error) {
+	base, err := newBaseDBWithEngine(path, engine, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &codeDB{base}, nil
+}
+
 type codeDB struct {
 	*baseDB
 }
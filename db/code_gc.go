@@ -0,0 +1,172 @@
+package db
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/0xsoniclabs/substate/types"
+	trlp "github.com/0xsoniclabs/substate/types/rlp"
+	"github.com/0xsoniclabs/substate/updateset"
+)
+
+const defaultCodeGCBatchSize = 1000
+
+// CodeGCConfig contains options of CollectCodeGarbage.
+type CodeGCConfig struct {
+	Delete    bool // delete orphaned codes; otherwise the collection is a dry run which only reports them
+	BatchSize int  // number of codes deleted per batch; 1000 if not positive
+}
+
+// OrphanedCode is a code which is neither referenced by a substate nor by an update set.
+type OrphanedCode struct {
+	Hash types.Hash
+	Size int
+}
+
+// CodeGCReport summarizes a run of CollectCodeGarbage.
+type CodeGCReport struct {
+	Substates  int64 // number of scanned substates
+	UpdateSets int64 // number of scanned update sets
+	Referenced int   // number of distinct referenced code hashes
+	Codes      int64 // number of scanned codes
+
+	Orphaned      []OrphanedCode // orphaned codes ordered by hash
+	OrphanedBytes int64          // total size of orphaned codes
+	Deleted       int64          // number of deleted codes
+	DryRun        bool           // true if orphaned codes were not deleted
+}
+
+// Print writes every orphaned code and a summary into w.
+func (r *CodeGCReport) Print(w io.Writer) error {
+	action := "deleted"
+	if r.DryRun {
+		action = "would delete"
+	}
+	for _, code := range r.Orphaned {
+		if _, err := fmt.Fprintf(w, "%s code %s (%d bytes)\n", action, code.Hash, code.Size); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "scanned %d substates, %d update sets and %d codes; %d codes referenced, %d orphaned (%d bytes), %d deleted\n",
+		r.Substates, r.UpdateSets, r.Codes, r.Referenced, len(r.Orphaned), r.OrphanedBytes, r.Deleted)
+	return err
+}
+
+// CollectCodeGarbage finds codes of db which are not referenced by any substate or update
+// set stored in db and deletes them if cfg.Delete is set.
+//
+// The mark phase decodes every substate and update set and collects the code hashes of
+// their accounts and the init code hashes of contract creations. The sweep phase reports
+// every code whose hash was not collected. Codes are deleted in batches of cfg.BatchSize.
+// The db must not be written while collecting, otherwise codes of new substates may be deleted.
+func CollectCodeGarbage(db SubstateDB, cfg CodeGCConfig) (*CodeGCReport, error) {
+	report := &CodeGCReport{DryRun: !cfg.Delete}
+	referenced := make(map[types.Hash]struct{})
+
+	// mark codes referenced by substates; decoding looks up every referenced code hash
+	mark := func(codeHash types.Hash) ([]byte, error) {
+		referenced[codeHash] = struct{}{}
+		return nil, nil
+	}
+	encoding, err := newSubstateEncoding(db.GetSubstateEncoding(), mark)
+	if err != nil {
+		return nil, fmt.Errorf("cannot collect code garbage; %w", err)
+	}
+
+	iter := db.NewIterator([]byte(SubstateDBPrefix), nil)
+	for iter.Next() {
+		block, tx, err := DecodeSubstateDBKey(iter.Key())
+		if err != nil {
+			iter.Release()
+			return nil, fmt.Errorf("invalid substate key: %v; %w", iter.Key(), err)
+		}
+		if _, err = encoding.decode(iter.Value(), block, tx); err != nil {
+			iter.Release()
+			return nil, err
+		}
+		report.Substates++
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return nil, fmt.Errorf("cannot iterate substates; %w", err)
+	}
+
+	// mark codes referenced by update sets
+	iter = db.NewIterator([]byte(UpdateDBPrefix), nil)
+	for iter.Next() {
+		var updateSet updateset.UpdateSetRLP
+		if err = trlp.DecodeBytes(iter.Value(), &updateSet); err != nil {
+			iter.Release()
+			return nil, fmt.Errorf("cannot decode update-set rlp key %v; %w", iter.Key(), err)
+		}
+		for _, acc := range updateSet.WorldState.Accounts {
+			referenced[acc.CodeHash] = struct{}{}
+		}
+		report.UpdateSets++
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return nil, fmt.Errorf("cannot iterate update sets; %w", err)
+	}
+	report.Referenced = len(referenced)
+
+	// sweep unreferenced codes
+	iter = db.NewIterator([]byte(CodeDBPrefix), nil)
+	for iter.Next() {
+		codeHash, err := DecodeCodeDBKey(iter.Key())
+		if err != nil {
+			iter.Release()
+			return nil, fmt.Errorf("invalid code key: %v; %w", iter.Key(), err)
+		}
+		report.Codes++
+		if _, ok := referenced[codeHash]; ok {
+			continue
+		}
+		report.Orphaned = append(report.Orphaned, OrphanedCode{Hash: codeHash, Size: len(iter.Value())})
+		report.OrphanedBytes += int64(len(iter.Value()))
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return nil, fmt.Errorf("cannot iterate codes; %w", err)
+	}
+
+	if cfg.Delete {
+		if err = deleteCodes(db, report, cfg.BatchSize); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// deleteCodes deletes the orphaned codes of report in batches of batchSize.
+func deleteCodes(db SubstateDB, report *CodeGCReport, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = defaultCodeGCBatchSize
+	}
+
+	batch := db.NewBatch()
+	pending := 0
+	for _, code := range report.Orphaned {
+		if err := batch.Delete(CodeDBKey(code.Hash)); err != nil {
+			return err
+		}
+		pending++
+		if pending < batchSize {
+			continue
+		}
+		if err := batch.Write(); err != nil {
+			return fmt.Errorf("cannot write batch; %w", err)
+		}
+		batch.Reset()
+		report.Deleted += int64(pending)
+		pending = 0
+	}
+
+	if pending > 0 {
+		if err := batch.Write(); err != nil {
+			return fmt.Errorf("cannot write batch; %w", err)
+		}
+		report.Deleted += int64(pending)
+	}
+	return nil
+}
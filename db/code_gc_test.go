@@ -0,0 +1,81 @@
+package db
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/0xsoniclabs/substate/types/hash"
+	"github.com/0xsoniclabs/substate/updateset"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectCodeGarbage_DryRunReportsOrphanedCodes(t *testing.T) {
+	for _, encoding := range []string{"rlp", "protobuf"} {
+		t.Run(encoding, func(t *testing.T) {
+			orphan := []byte("orphaned code")
+			db := createTestSubstateDB(t, encoding, 1, 5, 2, orphan)
+			putTestUpdateSet(t, db, 1)
+
+			report, err := CollectCodeGarbage(db, CodeGCConfig{})
+			require.NoError(t, err)
+			require.Equal(t, int64(10), report.Substates)
+			require.Equal(t, int64(1), report.UpdateSets)
+			require.Equal(t, []OrphanedCode{{Hash: hash.Keccak256Hash(orphan), Size: len(orphan)}}, report.Orphaned)
+			require.Equal(t, int64(len(orphan)), report.OrphanedBytes)
+			require.Zero(t, report.Deleted)
+
+			has, err := db.HasCode(hash.Keccak256Hash(orphan))
+			require.NoError(t, err)
+			require.True(t, has, "dry run must not delete codes")
+
+			var out bytes.Buffer
+			require.NoError(t, report.Print(&out))
+			require.Contains(t, out.String(), "would delete code "+hash.Keccak256Hash(orphan).String())
+		})
+	}
+}
+
+func TestCollectCodeGarbage_DeletesCodesOfDeletedSubstates(t *testing.T) {
+	db := createTestSubstateDB(t, "rlp", 1, 5, 2, []byte{1}, []byte{2}, []byte{3})
+	putTestUpdateSet(t, db, 1)
+
+	// codes of the deleted contract creation are no longer referenced
+	deleted := newTestSubstate(3, 1)
+	require.NoError(t, db.DeleteSubstate(3, 1))
+
+	report, err := CollectCodeGarbage(db, CodeGCConfig{Delete: true, BatchSize: 2})
+	require.NoError(t, err)
+	require.Len(t, report.Orphaned, 6)
+	require.Equal(t, int64(6), report.Deleted)
+
+	for _, code := range [][]byte{deleted.Message.Data, deleted.InputSubstate[types.Address{1}].Code} {
+		has, err := db.HasCode(hash.Keccak256Hash(code))
+		require.NoError(t, err)
+		require.False(t, has)
+	}
+
+	// remaining substates and update sets are still complete
+	requireSameSubstates(t, createTestSubstateDB(t, "rlp", 1, 2, 2), db, 1, 2, 2)
+	_, err = MakeDefaultUpdateDBFromBaseDB(db).GetUpdateSet(1)
+	require.NoError(t, err)
+
+	report, err = CollectCodeGarbage(db, CodeGCConfig{Delete: true})
+	require.NoError(t, err)
+	require.Empty(t, report.Orphaned)
+
+	var out bytes.Buffer
+	require.NoError(t, report.Print(&out))
+	require.True(t, strings.HasPrefix(out.String(), "scanned 9 substates"))
+}
+
+// putTestUpdateSet stores an update set of given block with an account of its own code.
+func putTestUpdateSet(t *testing.T, db *substateDB, block uint64) {
+	updateSet := updateset.NewUpdateSet(substate.WorldState{
+		types.Address{3}: substate.NewAccount(1, big.NewInt(1), []byte("update-set code")),
+	}, block)
+	require.NoError(t, MakeDefaultUpdateDBFromBaseDB(db).PutUpdateSet(updateSet, nil))
+}
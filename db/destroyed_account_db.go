@@ -18,6 +18,15 @@ func NewDefaultDestroyedAccountDB(destroyedAccountDir string) (*DestroyedAccount
 	return newDestroyedAccountDB(destroyedAccountDir, nil, nil, nil)
 }
 
+// NewDestroyedAccountDBWithEngine creates new instance of DestroyedAccountDB stored in given Engine.
+func NewDestroyedAccountDBWithEngine(destroyedAccountDir string, engine Engine) (*DestroyedAccountDB, error) {
+	backend, err := newBaseDBWithEngine(destroyedAccountDir, engine, false)
+	if err != nil {
+		return nil, fmt.Errorf("error opening deletion-db %s: %w", destroyedAccountDir, err)
+	}
+	return MakeDefaultDestroyedAccountDBFromBaseDB(backend), nil
+}
+
 func MakeDefaultDestroyedAccountDBFromBaseDB(backend BaseDB) *DestroyedAccountDB {
 	return &DestroyedAccountDB{backend: backend}
 }
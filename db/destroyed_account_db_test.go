@@ -0,0 +1,89 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/types"
+)
+
+func TestDestroyedAccountDB_GetDestroyedAccounts(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		db, err := createDbAndPutDestroyedAccountsWithEngine(t.TempDir()+"test-db", engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		destroyed, resurrected, err := db.GetDestroyedAccounts(2, 1)
+		if err != nil {
+			t.Fatalf("get destroyed accounts returned error; %v", err)
+		}
+
+		if want := []types.Address{{2}}; !reflect.DeepEqual(destroyed, want) {
+			t.Fatalf("incorrect destroyed accounts\ngot: %v\nwant: %v", destroyed, want)
+		}
+
+		if want := []types.Address{{1}}; !reflect.DeepEqual(resurrected, want) {
+			t.Fatalf("incorrect resurrected accounts\ngot: %v\nwant: %v", resurrected, want)
+		}
+	})
+}
+
+func TestDestroyedAccountDB_GetAccountsDestroyedInRange(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		db, err := createDbAndPutDestroyedAccountsWithEngine(t.TempDir()+"test-db", engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// account 1 is resurrected in block 2
+		got, err := db.GetAccountsDestroyedInRange(1, 2)
+		if err != nil {
+			t.Fatalf("get accounts destroyed in range returned error; %v", err)
+		}
+
+		if want := []types.Address{{2}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("incorrect destroyed accounts\ngot: %v\nwant: %v", got, want)
+		}
+	})
+}
+
+func TestDestroyedAccountDB_GetFirstAndLastKey(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		db, err := createDbAndPutDestroyedAccountsWithEngine(t.TempDir()+"test-db", engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first, err := db.GetFirstKey()
+		if err != nil {
+			t.Fatalf("cannot get first key; %v", err)
+		}
+
+		last, err := db.GetLastKey()
+		if err != nil {
+			t.Fatalf("cannot get last key; %v", err)
+		}
+
+		if first != 1 || last != 2 {
+			t.Fatalf("incorrect keys\ngot: %v, %v\nwant: %v, %v", first, last, 1, 2)
+		}
+	})
+}
+
+func createDbAndPutDestroyedAccountsWithEngine(dbPath string, engine Engine) (*DestroyedAccountDB, error) {
+	db, err := NewDestroyedAccountDBWithEngine(dbPath, engine)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.SetDestroyedAccounts(1, 0, []types.Address{{1}}, nil); err != nil {
+		return nil, err
+	}
+
+	if err = db.SetDestroyedAccounts(2, 1, []types.Address{{2}}, []types.Address{{1}}); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
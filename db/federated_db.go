@@ -0,0 +1,318 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	ldbiterator "github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ErrReadOnlyFederation is returned when writing into a federated SubstateDB.
+var ErrReadOnlyFederation = errors.New("federated substate db is read-only")
+
+// SubstateDBShard is a SubstateDB holding the substates of blocks First to Last.
+type SubstateDBShard struct {
+	First uint64
+	Last  uint64
+	DB    SubstateDB
+}
+
+// NewFederatedSubstateDB returns a read-only SubstateDB combining shards of disjoint block
+// ranges into one logical db. Substates are read from the shard whose range contains
+// their block; substates stored in a shard outside of its range are ignored. Every other
+// record, such as codes, is read from the first shard containing it. Iterators, and hence
+// task pools, iterate across shard boundaries.
+//
+// All shards must be written with the same encoding. Closing the federated db closes
+// every shard.
+func NewFederatedSubstateDB(shards []SubstateDBShard) (SubstateDB, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("cannot federate substate dbs; no shards")
+	}
+	sorted := make([]SubstateDBShard, len(shards))
+	copy(sorted, shards)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].First < sorted[j].First
+	})
+
+	encoding := sorted[0].DB.GetSubstateEncoding()
+	for i, shard := range sorted {
+		if shard.First > shard.Last {
+			return nil, fmt.Errorf("cannot federate substate dbs; first block %v of shard is after last block %v", shard.First, shard.Last)
+		}
+		if i > 0 && shard.First <= sorted[i-1].Last {
+			return nil, fmt.Errorf("cannot federate substate dbs; shard of blocks %v-%v overlaps shard of blocks %v-%v", shard.First, shard.Last, sorted[i-1].First, sorted[i-1].Last)
+		}
+		if e := shard.DB.GetSubstateEncoding(); e != encoding {
+			return nil, fmt.Errorf("cannot federate substate dbs; %w: shard of blocks %v-%v is encoded with %v, expected %v", ErrSubstateEncodingMismatch, shard.First, shard.Last, e, encoding)
+		}
+	}
+
+	sdb := &substateDB{codeDB: &codeDB{&baseDB{backend: &federatedBackend{shards: sorted}}}}
+	if _, err := sdb.SetSubstateEncoding(encoding); err != nil {
+		return nil, fmt.Errorf("cannot federate substate dbs; %w", err)
+	}
+	return sdb, nil
+}
+
+// federatedBackend implements a read-only backend over the backends of shards ordered by block range.
+type federatedBackend struct {
+	shards []SubstateDBShard
+}
+
+// shard returns the shard whose block range contains given block, or nil.
+func (b *federatedBackend) shard(block uint64) *SubstateDBShard {
+	i := sort.Search(len(b.shards), func(i int) bool {
+		return b.shards[i].Last >= block
+	})
+	if i == len(b.shards) || b.shards[i].First > block {
+		return nil
+	}
+	return &b.shards[i]
+}
+
+// route returns the backends which may contain given key; substate keys are routed by block.
+func (b *federatedBackend) route(key []byte) []backend {
+	if bytes.HasPrefix(key, []byte(SubstateDBPrefix)) {
+		if block, _, err := DecodeSubstateDBKey(key); err == nil {
+			if shard := b.shard(block); shard != nil {
+				return []backend{shard.DB.getBackend()}
+			}
+			return nil
+		}
+	}
+	backends := make([]backend, len(b.shards))
+	for i, shard := range b.shards {
+		backends[i] = shard.DB.getBackend()
+	}
+	return backends
+}
+
+func (b *federatedBackend) Put([]byte, []byte) error {
+	return ErrReadOnlyFederation
+}
+
+func (b *federatedBackend) Delete([]byte) error {
+	return ErrReadOnlyFederation
+}
+
+// Close closes every shard.
+func (b *federatedBackend) Close() error {
+	var errs []error
+	for _, shard := range b.shards {
+		errs = append(errs, shard.DB.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (b *federatedBackend) Has(key []byte) (bool, error) {
+	for _, backend := range b.route(key) {
+		has, err := backend.Has(key)
+		if err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
+func (b *federatedBackend) Get(key []byte) ([]byte, error) {
+	for _, backend := range b.route(key) {
+		value, err := backend.Get(key)
+		if !errors.Is(err, leveldb.ErrNotFound) {
+			return value, err
+		}
+	}
+	return nil, leveldb.ErrNotFound
+}
+
+func (b *federatedBackend) NewBatch() Batch {
+	return readOnlyBatch{}
+}
+
+// NewIterator merges the iterators of every shard skipping substates outside of the block
+// range of their shard. Ranges within substates are clipped to the block range of each
+// shard, so shards outside of the range are not iterated at all.
+func (b *federatedBackend) NewIterator(r *util.Range) ldbiterator.Iterator {
+	var iters []ldbiterator.Iterator
+	for _, shard := range b.shards {
+		sr, ok := clipSubstateRange(r, shard.First, shard.Last)
+		if !ok {
+			continue
+		}
+		iters = append(iters, &shardIterator{Iterator: shard.DB.getBackend().NewIterator(sr), first: shard.First, last: shard.Last})
+	}
+	switch len(iters) {
+	case 0:
+		return ldbiterator.NewEmptyIterator(nil)
+	case 1:
+		return iters[0]
+	default:
+		return &uniqueIterator{Iterator: ldbiterator.NewMergedIterator(iters, comparer.DefaultComparer, true)}
+	}
+}
+
+// Stat returns the stats of every shard.
+func (b *federatedBackend) Stat(property string) (string, error) {
+	var stats strings.Builder
+	for _, shard := range b.shards {
+		stat, err := shard.DB.Stat(property)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stats, "shard %v-%v:\n%s\n", shard.First, shard.Last, stat)
+	}
+	return stats.String(), nil
+}
+
+func (b *federatedBackend) Compact([]byte, []byte) error {
+	return ErrReadOnlyFederation
+}
+
+// clipSubstateRange returns r clipped to the substates of blocks first to last if r lies
+// within the substate prefix; other ranges are returned unchanged. It returns false if
+// the clipped range is empty.
+func clipSubstateRange(r *util.Range, first, last uint64) (*util.Range, bool) {
+	prefix := util.BytesPrefix([]byte(SubstateDBPrefix))
+	if r == nil || bytes.Compare(r.Start, prefix.Start) < 0 || r.Limit == nil || bytes.Compare(r.Limit, prefix.Limit) > 0 {
+		return r, true
+	}
+
+	clipped := &util.Range{Start: SubstateDBBlockPrefix(first), Limit: prefix.Limit}
+	if last < math.MaxUint64 {
+		clipped.Limit = SubstateDBBlockPrefix(last + 1)
+	}
+	if bytes.Compare(r.Start, clipped.Start) > 0 {
+		clipped.Start = r.Start
+	}
+	if bytes.Compare(r.Limit, clipped.Limit) < 0 {
+		clipped.Limit = r.Limit
+	}
+	return clipped, bytes.Compare(clipped.Start, clipped.Limit) < 0
+}
+
+// shardIterator skips substates outside of blocks first to last; other records are iterated unchanged.
+type shardIterator struct {
+	ldbiterator.Iterator
+	first, last uint64
+}
+
+func (i *shardIterator) First() bool {
+	return i.skipForward(i.Iterator.First())
+}
+
+func (i *shardIterator) Last() bool {
+	return i.skipBackward(i.Iterator.Last())
+}
+
+func (i *shardIterator) Seek(key []byte) bool {
+	return i.skipForward(i.Iterator.Seek(key))
+}
+
+func (i *shardIterator) Next() bool {
+	return i.skipForward(i.Iterator.Next())
+}
+
+func (i *shardIterator) Prev() bool {
+	return i.skipBackward(i.Iterator.Prev())
+}
+
+func (i *shardIterator) skipForward(ok bool) bool {
+	for ok && !i.contains(i.Iterator.Key()) {
+		ok = i.Iterator.Next()
+	}
+	return ok
+}
+
+func (i *shardIterator) skipBackward(ok bool) bool {
+	for ok && !i.contains(i.Iterator.Key()) {
+		ok = i.Iterator.Prev()
+	}
+	return ok
+}
+
+// contains reports whether key is not a substate key or a substate of the range of the shard.
+func (i *shardIterator) contains(key []byte) bool {
+	if !bytes.HasPrefix(key, []byte(SubstateDBPrefix)) {
+		return true
+	}
+	block, _, err := DecodeSubstateDBKey(key)
+	return err != nil || (block >= i.first && block <= i.last)
+}
+
+// uniqueIterator skips keys equal to the previous key, hence a key stored in several
+// shards is iterated once with the value of the first shard.
+type uniqueIterator struct {
+	ldbiterator.Iterator
+	key []byte
+}
+
+func (i *uniqueIterator) First() bool {
+	return i.remember(i.Iterator.First())
+}
+
+func (i *uniqueIterator) Last() bool {
+	return i.remember(i.Iterator.Last())
+}
+
+func (i *uniqueIterator) Seek(key []byte) bool {
+	return i.remember(i.Iterator.Seek(key))
+}
+
+func (i *uniqueIterator) Next() bool {
+	for i.Iterator.Next() {
+		if i.key == nil || !bytes.Equal(i.Iterator.Key(), i.key) {
+			return i.remember(true)
+		}
+	}
+	return i.remember(false)
+}
+
+func (i *uniqueIterator) Prev() bool {
+	for i.Iterator.Prev() {
+		if i.key == nil || !bytes.Equal(i.Iterator.Key(), i.key) {
+			return i.remember(true)
+		}
+	}
+	return i.remember(false)
+}
+
+func (i *uniqueIterator) remember(ok bool) bool {
+	if ok {
+		i.key = append(i.key[:0], i.Iterator.Key()...)
+	} else {
+		i.key = nil
+	}
+	return ok
+}
+
+// readOnlyBatch is the batch of a federated db; it fails to write.
+type readOnlyBatch struct{}
+
+func (readOnlyBatch) Put([]byte, []byte) error {
+	return ErrReadOnlyFederation
+}
+
+func (readOnlyBatch) Delete([]byte) error {
+	return ErrReadOnlyFederation
+}
+
+func (readOnlyBatch) ValueSize() int {
+	return 0
+}
+
+func (readOnlyBatch) Write() error {
+	return ErrReadOnlyFederation
+}
+
+func (readOnlyBatch) Reset() {}
+
+func (readOnlyBatch) Replay(KeyValueWriter) error {
+	return nil
+}
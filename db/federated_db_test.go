@@ -0,0 +1,191 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types/hash"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var federatedTestCode = []byte("code stored in every shard")
+
+// createFederatedTestDB returns a federated db of 3 shards holding 2 blocks of 2 transactions each.
+func createFederatedTestDB(t *testing.T, encoding string) SubstateDB {
+	var shards []SubstateDBShard
+	for first := uint64(1); first <= 5; first += 2 {
+		shard := createTestSubstateDB(t, encoding, first, first+1, 2, federatedTestCode)
+		shards = append(shards, SubstateDBShard{First: first, Last: first + 1, DB: shard})
+	}
+
+	// substate outside of the range of its shard
+	require.NoError(t, shards[0].DB.PutSubstate(newTestSubstate(7, 0)))
+
+	// shards are sorted by their range
+	shards[0], shards[2] = shards[2], shards[0]
+	db, err := NewFederatedSubstateDB(shards)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, db.Close()) })
+	return db
+}
+
+func TestFederatedSubstateDB_RoutesSubstatesByBlock(t *testing.T) {
+	for _, encoding := range []string{"rlp", "protobuf"} {
+		t.Run(encoding, func(t *testing.T) {
+			db := createFederatedTestDB(t, encoding)
+			require.Equal(t, encoding, db.GetSubstateEncoding())
+
+			for block := uint64(1); block <= 6; block++ {
+				has, err := db.HasSubstate(block, 1)
+				require.NoError(t, err)
+				require.True(t, has)
+
+				ss, err := db.GetSubstate(block, 1)
+				require.NoError(t, err)
+				require.NoError(t, ss.Equal(newTestSubstate(block, 1)))
+
+				substates, err := db.GetBlockSubstates(block)
+				require.NoError(t, err)
+				require.Len(t, substates, 2)
+			}
+
+			has, err := db.HasSubstate(7, 0)
+			require.NoError(t, err)
+			require.False(t, has, "substate outside of the range of its shard must be ignored")
+			_, err = db.GetSubstate(7, 0)
+			require.Error(t, err)
+
+			last, err := db.GetLastSubstate()
+			require.NoError(t, err)
+			require.Equal(t, uint64(6), last.Block)
+		})
+	}
+}
+
+func TestFederatedSubstateDB_IteratesAcrossShards(t *testing.T) {
+	db := createFederatedTestDB(t, "rlp")
+
+	iter := db.NewSubstateIterator(2, 4)
+	var got []uint64
+	for iter.Next() {
+		got = append(got, iter.Value().Block)
+	}
+	require.NoError(t, iter.Error())
+	iter.Release()
+	require.Equal(t, []uint64{2, 2, 3, 3, 4, 4, 5, 5, 6, 6}, got)
+
+	rangeIter := db.NewSubstateRangeIterator(SubstateRange{FirstBlock: 2, FirstTx: 1, LastBlock: 5}, 2)
+	got = got[:0]
+	for rangeIter.Next() {
+		got = append(got, rangeIter.Value().Block)
+	}
+	require.NoError(t, rangeIter.Error())
+	rangeIter.Release()
+	require.Equal(t, []uint64{2, 3, 3, 4, 4, 5, 5}, got)
+
+	// codes stored in several shards are iterated once
+	codes := db.NewIterator([]byte(CodeDBPrefix), nil)
+	defer codes.Release()
+	shared := 0
+	for codes.Next() {
+		if codeHash, _ := DecodeCodeDBKey(codes.Key()); codeHash == hash.Keccak256Hash(federatedTestCode) {
+			shared++
+		}
+	}
+	require.NoError(t, codes.Error())
+	require.Equal(t, 1, shared)
+}
+
+func TestFederatedSubstateDB_SkipsSubstatesOutsideOfShardsInEveryRange(t *testing.T) {
+	db := createFederatedTestDB(t, "rlp")
+
+	want := []string{"1_0", "1_1", "2_0", "2_1", "3_0", "3_1", "4_0", "4_1", "5_0", "5_1", "6_0", "6_1"}
+	for name, r := range map[string]*util.Range{
+		"nil":      nil,
+		"all":      {},
+		"spanning": util.BytesPrefix([]byte("1")),
+		"prefix":   util.BytesPrefix([]byte(SubstateDBPrefix)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			iter := db.getBackend().NewIterator(r)
+			defer iter.Release()
+
+			var got []string
+			for iter.Next() {
+				if block, tx, err := DecodeSubstateDBKey(iter.Key()); err == nil {
+					got = append(got, fmt.Sprintf("%v_%v", block, tx))
+				}
+			}
+			require.NoError(t, iter.Error())
+			require.Equal(t, want, got)
+
+			// iterating backwards skips the same substates
+			got = got[:0]
+			for ok := iter.Last(); ok; ok = iter.Prev() {
+				if block, tx, err := DecodeSubstateDBKey(iter.Key()); err == nil {
+					got = append([]string{fmt.Sprintf("%v_%v", block, tx)}, got...)
+				}
+			}
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestFederatedSubstateDB_ExecutesTaskPoolAcrossShards(t *testing.T) {
+	db := createFederatedTestDB(t, "protobuf")
+
+	var (
+		lock     sync.Mutex
+		executed = make(map[uint64]int)
+	)
+	taskFunc := func(block uint64, tx int, ss *substate.Substate, taskPool *SubstateTaskPool) error {
+		lock.Lock()
+		defer lock.Unlock()
+		executed[block]++
+		return nil
+	}
+	pool := db.NewSubstateTaskPoolWithConfig("test", taskFunc, 1, 7, TaskPoolConfig{Workers: 2, Progress: SilentProgressReporter{}})
+	require.NoError(t, pool.Execute())
+	require.Equal(t, map[uint64]int{1: 2, 2: 2, 3: 2, 4: 2, 5: 2, 6: 2}, executed)
+}
+
+func TestFederatedSubstateDB_LooksUpCodesInEveryShard(t *testing.T) {
+	db := createFederatedTestDB(t, "rlp")
+
+	for _, code := range [][]byte{{1, 0}, {6, 1}, federatedTestCode} {
+		got, err := db.GetCode(hash.Keccak256Hash(code))
+		require.NoError(t, err)
+		require.Equal(t, code, got)
+	}
+	has, err := db.HasCode(hash.Keccak256Hash([]byte("missing code")))
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+func TestFederatedSubstateDB_IsReadOnly(t *testing.T) {
+	db := createFederatedTestDB(t, "rlp")
+
+	require.ErrorIs(t, db.PutSubstate(newTestSubstate(8, 0)), ErrReadOnlyFederation)
+	require.ErrorIs(t, db.DeleteSubstate(1, 0), ErrReadOnlyFederation)
+	require.ErrorIs(t, db.NewBatch().Write(), ErrReadOnlyFederation)
+}
+
+func TestNewFederatedSubstateDB_RejectsInvalidShards(t *testing.T) {
+	rlpDB := createTestSubstateDB(t, "rlp", 1, 1, 1)
+	protobufDB := createTestSubstateDB(t, "protobuf", 1, 1, 1)
+
+	_, err := NewFederatedSubstateDB(nil)
+	require.ErrorContains(t, err, "no shards")
+
+	_, err = NewFederatedSubstateDB([]SubstateDBShard{{First: 2, Last: 1, DB: rlpDB}})
+	require.ErrorContains(t, err, "first block 2 of shard is after last block 1")
+
+	_, err = NewFederatedSubstateDB([]SubstateDBShard{{First: 1, Last: 5, DB: rlpDB}, {First: 5, Last: 9, DB: rlpDB}})
+	require.ErrorContains(t, err, "shard of blocks 5-9 overlaps shard of blocks 1-5")
+
+	_, err = NewFederatedSubstateDB([]SubstateDBShard{{First: 1, Last: 4, DB: rlpDB}, {First: 5, Last: 9, DB: protobufDB}})
+	require.ErrorIs(t, err, ErrSubstateEncodingMismatch)
+}
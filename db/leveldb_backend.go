@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	ldbiterator "github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func openLevelDBBackend(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.ReadOptions) (*levelDBBackend, error) {
+	b, err := leveldb.OpenFile(path, o)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open leveldb; %w", err)
+	}
+	return newLevelDBBackend(b, wo, ro), nil
+}
+
+func newLevelDBBackend(db *leveldb.DB, wo *opt.WriteOptions, ro *opt.ReadOptions) *levelDBBackend {
+	return &levelDBBackend{
+		db: db,
+		wo: wo,
+		ro: ro,
+	}
+}
+
+// levelDBBackend implements backend using goleveldb.
+type levelDBBackend struct {
+	db *leveldb.DB
+	wo *opt.WriteOptions
+	ro *opt.ReadOptions
+}
+
+func (b *levelDBBackend) Put(key []byte, value []byte) error {
+	return b.db.Put(key, value, b.wo)
+}
+
+func (b *levelDBBackend) Delete(key []byte) error {
+	return b.db.Delete(key, b.wo)
+}
+
+func (b *levelDBBackend) Close() error {
+	return b.db.Close()
+}
+
+func (b *levelDBBackend) Has(key []byte) (bool, error) {
+	return b.db.Has(key, b.ro)
+}
+
+func (b *levelDBBackend) Get(key []byte) ([]byte, error) {
+	return b.db.Get(key, b.ro)
+}
+
+func (b *levelDBBackend) NewBatch() Batch {
+	return newBatch(b.db)
+}
+
+func (b *levelDBBackend) NewIterator(r *util.Range) ldbiterator.Iterator {
+	return b.db.NewIterator(r, b.ro)
+}
+
+func (b *levelDBBackend) Stat(property string) (string, error) {
+	return b.db.GetProperty(property)
+}
+
+func (b *levelDBBackend) Compact(start []byte, limit []byte) error {
+	return b.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
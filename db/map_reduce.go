@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/0xsoniclabs/substate/substate"
+)
+
+// SubstateMapFunc maps a substate to a value of type T. It is called concurrently.
+type SubstateMapFunc[T any] func(ss *substate.Substate) (T, error)
+
+// ReduceFunc folds value into the partial result acc, which is the zero value of R for the first value.
+type ReduceFunc[T, R any] func(acc R, value T) R
+
+// MergeFunc merges partial result b into a; b covers substates following the substates covered by a.
+type MergeFunc[R any] func(a, b R) R
+
+// mapReduceBatchSize is the number of consecutive substates folded into a single partial result.
+const mapReduceBatchSize = 64
+
+type mapReduceBatch struct {
+	seq       int
+	substates []*substate.Substate
+}
+
+type mapReduceResult[R any] struct {
+	seq     int
+	partial R
+	err     error
+}
+
+// MapReduce maps every substate of range r with mapFunc and folds the values with reduceFunc.
+//
+// Substates are decoded by the parallel substate iterator and split into batches of
+// consecutive substates. Each of numWorkers workers maps and folds whole batches into
+// partial results, which are merged with mergeFunc in (block, tx) order. Values are thus
+// always folded in (block, tx) order and the result does not depend on numWorkers.
+//
+// If mapFunc fails, the error of the first failed substate in order is returned. If ctx
+// is done, MapReduce stops and returns ctx.Err().
+func MapReduce[T, R any](ctx context.Context, db SubstateDB, r SubstateRange, numWorkers int, mapFunc SubstateMapFunc[T], reduceFunc ReduceFunc[T, R], mergeFunc MergeFunc[R]) (R, error) {
+	var zero R
+	if numWorkers <= 0 {
+		numWorkers = 1
+	}
+
+	iter := db.NewSubstateRangeIterator(r, numWorkers)
+	defer iter.Release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	wg := sync.WaitGroup{}
+	defer func() {
+		// stop batch producer and workers before releasing the iterator
+		cancel()
+		wg.Wait()
+	}()
+
+	batchChan := make(chan mapReduceBatch, numWorkers)
+	resultChan := make(chan mapReduceResult[R], numWorkers)
+
+	// split substates into batches
+	wg.Add(1)
+	go func() {
+		defer func() {
+			close(batchChan)
+			wg.Done()
+		}()
+
+		batch := mapReduceBatch{}
+		send := func() bool {
+			select {
+			case batchChan <- batch:
+				batch = mapReduceBatch{seq: batch.seq + 1}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for iter.Next() {
+			if ctx.Err() != nil {
+				return
+			}
+			batch.substates = append(batch.substates, iter.Value())
+			if len(batch.substates) == mapReduceBatchSize && !send() {
+				return
+			}
+		}
+		if len(batch.substates) > 0 {
+			send()
+		}
+	}()
+
+	// map and fold batches into partial results
+	workers := sync.WaitGroup{}
+	for i := 0; i < numWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			for batch := range batchChan {
+				res := mapReduceResult[R]{seq: batch.seq}
+				for _, ss := range batch.substates {
+					value, err := mapFunc(ss)
+					if err != nil {
+						res.err = fmt.Errorf("%v_%v: %w", ss.Block, ss.Transaction, err)
+						break
+					}
+					res.partial = reduceFunc(res.partial, value)
+				}
+
+				select {
+				case resultChan <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workers.Wait()
+		close(resultChan)
+	}()
+
+	// merge partial results in order
+	result := zero
+	next := 0
+	pending := make(map[int]mapReduceResult[R])
+	for res := range resultChan {
+		pending[res.seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if res.err != nil {
+				return zero, res.err
+			}
+			if next == 0 {
+				result = res.partial
+			} else {
+				result = mergeFunc(result, res.partial)
+			}
+			next++
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	if err := iter.Error(); err != nil {
+		return zero, fmt.Errorf("cannot iterate substates; %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/stretchr/testify/require"
+)
+
+func createMapReduceTestDB(t *testing.T, numBlocks uint64, txsPerBlock int) *substateDB {
+	db, err := newSubstateDB(t.TempDir()+"test-db", nil, nil, nil)
+	require.NoError(t, err)
+	for block := uint64(1); block <= numBlocks; block++ {
+		for tx := 0; tx < txsPerBlock; tx++ {
+			ss := *testSubstate
+			ss.Transaction = tx
+			require.NoError(t, addCustomSubstate(db, block, &ss))
+		}
+	}
+	return db
+}
+
+func TestMapReduce_Order(t *testing.T) {
+	db := createMapReduceTestDB(t, 50, 7)
+
+	mapFunc := func(ss *substate.Substate) (string, error) {
+		return fmt.Sprintf("%v_%v", ss.Block, ss.Transaction), nil
+	}
+	reduceFunc := func(acc []string, value string) []string {
+		return append(acc, value)
+	}
+	mergeFunc := func(a, b []string) []string {
+		return append(a, b...)
+	}
+
+	var want []string
+	for block := 10; block <= 20; block++ {
+		for tx := 0; tx < 7; tx++ {
+			want = append(want, fmt.Sprintf("%v_%v", block, tx))
+		}
+	}
+
+	for _, workers := range []int{0, 1, 4, 16} {
+		got, err := MapReduce(context.Background(), db, SubstateRange{FirstBlock: 10, LastBlock: 20}, workers, mapFunc, reduceFunc, mergeFunc)
+		require.NoError(t, err)
+		require.Equal(t, want, got, "workers %v", workers)
+	}
+}
+
+func TestMapReduce_Sum(t *testing.T) {
+	db := createMapReduceTestDB(t, 30, 10)
+
+	gas, err := MapReduce(context.Background(), db, SubstateRange{FirstBlock: 0, LastBlock: 30}, 4,
+		func(ss *substate.Substate) (uint64, error) { return ss.Result.GasUsed, nil },
+		func(acc, value uint64) uint64 { return acc + value },
+		func(a, b uint64) uint64 { return a + b },
+	)
+	require.NoError(t, err)
+	require.Equal(t, uint64(300)*testSubstate.Result.GasUsed, gas)
+
+	count, err := MapReduce(context.Background(), db, SubstateRange{FirstBlock: 40, LastBlock: 50}, 4,
+		func(ss *substate.Substate) (int, error) { return 1, nil },
+		func(acc, value int) int { return acc + value },
+		func(a, b int) int { return a + b },
+	)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func TestMapReduce_MapError(t *testing.T) {
+	db := createMapReduceTestDB(t, 30, 10)
+
+	mapErr := errors.New("map failed")
+	_, err := MapReduce(context.Background(), db, SubstateRange{FirstBlock: 1, LastBlock: 30}, 8,
+		func(ss *substate.Substate) (int, error) {
+			if ss.Block >= 17 && ss.Transaction == 3 {
+				return 0, mapErr
+			}
+			return 1, nil
+		},
+		func(acc, value int) int { return acc + value },
+		func(a, b int) int { return a + b },
+	)
+	require.ErrorIs(t, err, mapErr)
+	require.ErrorContains(t, err, "17_3")
+}
+
+func TestMapReduce_Cancel(t *testing.T) {
+	db := createMapReduceTestDB(t, 30, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mapped int
+	_, err := MapReduce(ctx, db, SubstateRange{FirstBlock: 1, LastBlock: 30}, 1,
+		func(ss *substate.Substate) (int, error) {
+			mapped++
+			if mapped == 10 {
+				cancel()
+			}
+			return 1, nil
+		},
+		func(acc, value int) int { return acc + value },
+		func(a, b int) int { return a + b },
+	)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, mapped, 300)
+}
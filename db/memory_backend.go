@@ -0,0 +1,150 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	ldbiterator "github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const memoryStatsProperty = "memory.stats"
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		db: memdb.New(comparer.DefaultComparer, 0),
+	}
+}
+
+// memoryBackend implements backend using an in-memory sorted map.
+type memoryBackend struct {
+	lock sync.RWMutex // guards batch writes against single-key operations
+	db   *memdb.DB
+}
+
+func (b *memoryBackend) Put(key []byte, value []byte) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.db.Put(key, value)
+}
+
+func (b *memoryBackend) Delete(key []byte) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	err := b.db.Delete(key)
+	if err == memdb.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Close releases all stored data.
+func (b *memoryBackend) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.db.Reset()
+	return nil
+}
+
+func (b *memoryBackend) Has(key []byte) (bool, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.db.Contains(key), nil
+}
+
+func (b *memoryBackend) Get(key []byte) ([]byte, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	value, err := b.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (b *memoryBackend) NewBatch() Batch {
+	return &memoryBatch{backend: b}
+}
+
+func (b *memoryBackend) NewIterator(r *util.Range) ldbiterator.Iterator {
+	return b.db.NewIterator(r)
+}
+
+func (b *memoryBackend) Stat(property string) (string, error) {
+	switch property {
+	case leveldbStatsProperty, memoryStatsProperty:
+		return fmt.Sprintf("entries: %d, size: %d", b.db.Len(), b.db.Size()), nil
+	default:
+		return "", fmt.Errorf("unknown property: %s", property)
+	}
+}
+
+// Compact is a no-op since the in-memory store has nothing to compact.
+func (b *memoryBackend) Compact([]byte, []byte) error {
+	return nil
+}
+
+type memoryBatchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// memoryBatch buffers operations and applies them to the memoryBackend under an exclusive lock.
+type memoryBatch struct {
+	backend *memoryBackend
+	ops     []memoryBatchOp
+	size    int
+}
+
+func (b *memoryBatch) Put(key []byte, value []byte) error {
+	b.ops = append(b.ops, memoryBatchOp{key: append([]byte{}, key...), value: append([]byte{}, value...)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.ops = append(b.ops, memoryBatchOp{key: append([]byte{}, key...), delete: true})
+	b.size += len(key)
+	return nil
+}
+
+func (b *memoryBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *memoryBatch) Write() error {
+	b.backend.lock.Lock()
+	defer b.backend.lock.Unlock()
+	for _, op := range b.ops {
+		if op.delete {
+			if err := b.backend.db.Delete(op.key); err != nil && err != memdb.ErrNotFound {
+				return err
+			}
+			continue
+		}
+		if err := b.backend.db.Put(op.key, op.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memoryBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+func (b *memoryBatch) Replay(w KeyValueWriter) error {
+	r := &replayer{writer: w}
+	for _, op := range b.ops {
+		if op.delete {
+			r.Delete(op.key)
+		} else {
+			r.Put(op.key, op.value)
+		}
+	}
+	return r.failure
+}
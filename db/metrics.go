@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/0xsoniclabs/substate/substate"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics collects statistics of substate replay runs and exports them in the
+// Prometheus text exposition format. Metrics are opt-in: set SubstateTaskPool.Metrics
+// to record them and call Serve to expose them to a scraper.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	blocks       prometheus.Counter
+	transactions prometheus.Counter
+	gas          prometheus.Counter
+	watermark    prometheus.Gauge
+	blockTime    prometheus.Histogram
+	decodeTime   prometheus.Histogram
+	readBytes    prometheus.Counter
+}
+
+// NewMetrics creates Metrics with its own registry.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		blocks: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "substate_replay_blocks_total",
+			Help: "Number of executed blocks.",
+		}),
+		transactions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "substate_replay_transactions_total",
+			Help: "Number of executed transactions.",
+		}),
+		gas: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "substate_replay_gas_total",
+			Help: "Gas used by executed transactions.",
+		}),
+		watermark: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "substate_replay_watermark",
+			Help: "Next block to be completed in order; all blocks before it are completed.",
+		}),
+		blockTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "substate_replay_block_duration_seconds",
+			Help:    "Time spent executing a single block including reading its substates.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 20),
+		}),
+		decodeTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "substate_decode_duration_seconds",
+			Help:    "Time spent decoding a single substate.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 20),
+		}),
+		readBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "substate_db_read_bytes_total",
+			Help: "Number of encoded substate bytes read from the database.",
+		}),
+	}
+	m.registry.MustRegister(m.blocks, m.transactions, m.gas, m.watermark, m.blockTime, m.decodeTime, m.readBytes)
+	return m
+}
+
+// Registry returns the registry containing all metrics, e.g. to register additional collectors.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns an HTTP handler serving all metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Serve starts an HTTP listener on given address (e.g. "localhost:9090") serving
+// metrics on /metrics. The returned server should be closed once the run finishes.
+// If the server fails after it was started, onError is called with the failure;
+// onError may be nil to ignore such failures.
+func (m *Metrics) Serve(addr string, onError func(error)) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %v; %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{
+		Addr:              listener.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) && onError != nil {
+			onError(fmt.Errorf("metrics server on %v failed; %w", server.Addr, err))
+		}
+	}()
+	return server, nil
+}
+
+// recordBlock records an executed block; it is nil-safe.
+func (m *Metrics) recordBlock(numTx, gas int64, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.blocks.Inc()
+	m.transactions.Add(float64(numTx))
+	m.gas.Add(float64(gas))
+	m.blockTime.Observe(duration.Seconds())
+}
+
+// recordWatermark records the progress of an execution; it is nil-safe.
+func (m *Metrics) recordWatermark(block uint64) {
+	if m == nil {
+		return
+	}
+	m.watermark.Set(float64(block))
+}
+
+// recordDecode records a decoded substate; it is nil-safe.
+func (m *Metrics) recordDecode(numBytes int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.readBytes.Add(float64(numBytes))
+	m.decodeTime.Observe(duration.Seconds())
+}
+
+// meteredBlockReader is implemented by SubstateDBs able to record the decoding of
+// substates into the Metrics of the SubstateTaskPool reading them.
+type meteredBlockReader interface {
+	getBlockSubstates(block uint64, m *Metrics) (map[int]*substate.Substate, error)
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xsoniclabs/substate/substate"
+)
+
+func TestMetrics_SubstateTaskPool(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add one more substate
+	if err = addSubstate(db, testSubstate.Block+1); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMetrics()
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			return nil
+		},
+
+		First: testSubstate.Block,
+		Last:  testSubstate.Block + 1,
+
+		Workers:  1,
+		Progress: SilentProgressReporter{},
+		Metrics:  m,
+		DB:       db,
+	}
+	require.NoError(t, stPool.Execute())
+
+	server, err := m.Serve("127.0.0.1:0", func(err error) { t.Error(err) })
+	require.NoError(t, err)
+	defer server.Close()
+
+	resp, err := http.Get("http://" + server.Addr + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	text := string(body)
+
+	for _, want := range []string{
+		"substate_replay_blocks_total 2",
+		"substate_replay_transactions_total 2",
+		"substate_replay_gas_total 2",
+		"substate_replay_watermark 3.7534836e+07",
+		"substate_replay_block_duration_seconds_count 2",
+		"substate_decode_duration_seconds_count 2",
+		"substate_db_read_bytes_total ",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("metrics do not contain %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestMetrics_ConcurrentPoolsRecordOwnDecoding(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pools sharing the db record only the substates they read themselves
+	metrics := []*Metrics{NewMetrics(), nil, NewMetrics()}
+	var wg sync.WaitGroup
+	for _, m := range metrics {
+		stPool := SubstateTaskPool{
+			Name:     "test",
+			First:    testSubstate.Block,
+			Last:     testSubstate.Block,
+			Workers:  1,
+			Progress: SilentProgressReporter{},
+			Metrics:  m,
+			DB:       db,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				require.NoError(t, stPool.Execute())
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, m := range metrics {
+		if m != nil {
+			require.Equal(t, uint64(10), sampleCount(t, m, "substate_replay_block_duration_seconds"))
+			require.Equal(t, uint64(10), sampleCount(t, m, "substate_decode_duration_seconds"))
+		}
+	}
+}
+
+func TestMetrics_ServeFailsOnTakenAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// the address is taken, hence the server cannot be started at all
+	_, err = NewMetrics().Serve(listener.Addr().String(), nil)
+	require.ErrorContains(t, err, "cannot listen on")
+}
+
+// sampleCount returns the number of observations of the histogram of given name.
+func sampleCount(t *testing.T, m *Metrics, name string) uint64 {
+	families, err := m.Registry().Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	t.Fatalf("histogram %v not found", name)
+	return 0
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+	m.recordBlock(1, 1, 0)
+	m.recordWatermark(1)
+	m.recordDecode(1, 0)
+}
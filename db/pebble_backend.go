@@ -0,0 +1,254 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/syndtr/goleveldb/leveldb"
+	ldbiterator "github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const pebbleStatsProperty = "pebble.stats"
+
+func openPebbleBackend(path string, readOnly bool) (*pebbleBackend, error) {
+	b, err := pebble.Open(path, &pebble.Options{ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open pebble; %w", err)
+	}
+	return &pebbleBackend{db: b}, nil
+}
+
+// pebbleBackend implements backend using Pebble. Like the leveldb backend, it does not
+// sync writes to disk.
+type pebbleBackend struct {
+	db *pebble.DB
+}
+
+func (b *pebbleBackend) Put(key []byte, value []byte) error {
+	return b.db.Set(key, value, pebble.NoSync)
+}
+
+func (b *pebbleBackend) Delete(key []byte) error {
+	return b.db.Delete(key, pebble.NoSync)
+}
+
+func (b *pebbleBackend) Close() error {
+	return b.db.Close()
+}
+
+func (b *pebbleBackend) Has(key []byte) (bool, error) {
+	_, closer, err := b.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, closer.Close()
+}
+
+// Get returns a copy of the value since Pebble only guarantees it until the closer is closed.
+func (b *pebbleBackend) Get(key []byte) ([]byte, error) {
+	value, closer, err := b.db.Get(key)
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, leveldb.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := append([]byte{}, value...)
+	return res, closer.Close()
+}
+
+func (b *pebbleBackend) NewBatch() Batch {
+	return &pebbleBatch{db: b.db, b: b.db.NewBatch()}
+}
+
+func (b *pebbleBackend) NewIterator(r *util.Range) ldbiterator.Iterator {
+	o := new(pebble.IterOptions)
+	if r != nil {
+		o.LowerBound = r.Start
+		o.UpperBound = r.Limit
+	}
+	iter, err := b.db.NewIter(o)
+	if err != nil {
+		return ldbiterator.NewEmptyIterator(err)
+	}
+	return &pebbleIterator{iter: iter}
+}
+
+func (b *pebbleBackend) Stat(property string) (string, error) {
+	switch property {
+	case leveldbStatsProperty, pebbleStatsProperty:
+		return b.db.Metrics().String(), nil
+	default:
+		return "", fmt.Errorf("unknown property: %s", property)
+	}
+}
+
+// Compact resolves nil bounds to the first and last key since Pebble requires an explicit range.
+func (b *pebbleBackend) Compact(start []byte, limit []byte) error {
+	if start == nil || limit == nil {
+		iter, err := b.db.NewIter(nil)
+		if err != nil {
+			return err
+		}
+		if start == nil && iter.First() {
+			start = append([]byte{}, iter.Key()...)
+		}
+		if limit == nil && iter.Last() {
+			// limit is exclusive hence the last key is extended to be included
+			limit = append(append([]byte{}, iter.Key()...), 0)
+		}
+		if err = iter.Close(); err != nil {
+			return err
+		}
+		// empty database
+		if start == nil || limit == nil {
+			return nil
+		}
+	}
+	if string(start) >= string(limit) {
+		return nil
+	}
+	return b.db.Compact(start, limit, true)
+}
+
+// pebbleBatch implements Batch using Pebble's batch.
+type pebbleBatch struct {
+	db   *pebble.DB
+	b    *pebble.Batch
+	size int
+}
+
+func (b *pebbleBatch) Put(key []byte, value []byte) error {
+	b.size += len(value)
+	return b.b.Set(key, value, nil)
+}
+
+func (b *pebbleBatch) Delete(key []byte) error {
+	b.size += len(key)
+	return b.b.Delete(key, nil)
+}
+
+func (b *pebbleBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *pebbleBatch) Write() error {
+	return b.db.Apply(b.b, pebble.NoSync)
+}
+
+func (b *pebbleBatch) Reset() {
+	b.b.Reset()
+	b.size = 0
+}
+
+func (b *pebbleBatch) Replay(w KeyValueWriter) error {
+	r := &replayer{writer: w}
+	reader := b.b.Reader()
+	for {
+		kind, key, value, ok, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		if !ok || r.failure != nil {
+			break
+		}
+		switch kind {
+		case pebble.InternalKeyKindSet:
+			r.Put(key, value)
+		case pebble.InternalKeyKindDelete:
+			r.Delete(key)
+		}
+	}
+	return r.failure
+}
+
+// pebbleIterator adapts Pebble's iterator to the goleveldb iterator interface,
+// which is positioned before the first key until Next is called.
+type pebbleIterator struct {
+	iter     *pebble.Iterator
+	started  bool
+	err      error
+	released bool
+	releaser util.Releaser
+}
+
+func (i *pebbleIterator) First() bool {
+	i.started = true
+	return i.iter.First()
+}
+
+func (i *pebbleIterator) Last() bool {
+	i.started = true
+	return i.iter.Last()
+}
+
+func (i *pebbleIterator) Seek(key []byte) bool {
+	i.started = true
+	return i.iter.SeekGE(key)
+}
+
+func (i *pebbleIterator) Next() bool {
+	if i.released {
+		return false
+	}
+	if !i.started {
+		return i.First()
+	}
+	return i.iter.Next()
+}
+
+func (i *pebbleIterator) Prev() bool {
+	if i.released {
+		return false
+	}
+	if !i.started {
+		return i.Last()
+	}
+	return i.iter.Prev()
+}
+
+func (i *pebbleIterator) Key() []byte {
+	if i.released || !i.iter.Valid() {
+		return nil
+	}
+	return i.iter.Key()
+}
+
+func (i *pebbleIterator) Value() []byte {
+	if i.released || !i.iter.Valid() {
+		return nil
+	}
+	return i.iter.Value()
+}
+
+func (i *pebbleIterator) Valid() bool {
+	return !i.released && i.iter.Valid()
+}
+
+func (i *pebbleIterator) Error() error {
+	if i.released {
+		return i.err
+	}
+	return i.iter.Error()
+}
+
+func (i *pebbleIterator) Release() {
+	if i.released {
+		return
+	}
+	i.released = true
+	i.err = i.iter.Close()
+	if i.releaser != nil {
+		i.releaser.Release()
+		i.releaser = nil
+	}
+}
+
+func (i *pebbleIterator) SetReleaser(releaser util.Releaser) {
+	i.releaser = releaser
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"time"
+)
+
+// TaskPoolProgress is a snapshot of the progress of a SubstateTaskPool execution.
+type TaskPoolProgress struct {
+	Name    string
+	First   uint64 // first block of this execution; later than pool.First if resumed from a checkpoint
+	Last    uint64
+	Workers int
+
+	// Sampled is set if only a sample of blocks is executed; NumBlocks is then
+	// the sample size out of the Watermark-First blocks passed so far.
+	Sampled bool
+
+	// Watermark is the next block to be completed in order; all blocks before it are completed.
+	Watermark uint64
+
+	Elapsed   time.Duration
+	NumBlocks int64
+	NumTxs    int64
+	Gas       int64
+}
+
+// ProgressReporter receives the progress of a SubstateTaskPool execution.
+// Methods are called from a single goroutine.
+type ProgressReporter interface {
+	// Start is called once before any block is executed.
+	Start(progress TaskPoolProgress)
+
+	// Progress is called periodically while blocks are executed.
+	Progress(progress TaskPoolProgress)
+
+	// Finish is called once with the final totals when the execution stops, including on failure.
+	Finish(progress TaskPoolProgress)
+}
+
+// NewPrintProgressReporter returns a ProgressReporter which prints block range,
+// elapsed time and throughput (blk/s, tx/s, Mgas/s) to w.
+func NewPrintProgressReporter(w io.Writer) ProgressReporter {
+	return &printProgressReporter{w: w}
+}
+
+// DefaultProgressReporter returns the ProgressReporter used when none is configured; it prints to stdout.
+func DefaultProgressReporter() ProgressReporter {
+	return NewPrintProgressReporter(os.Stdout)
+}
+
+type printProgressReporter struct {
+	w    io.Writer
+	last TaskPoolProgress
+}
+
+func (r *printProgressReporter) Start(p TaskPoolProgress) {
+	r.last = p
+	fmt.Fprintf(r.w, "%s: block range = %v %v\n", p.Name, p.First, p.Last)
+	fmt.Fprintf(r.w, "%s: #CPU = %v, #worker = %v\n", p.Name, runtime.NumCPU(), p.Workers)
+}
+
+func (r *printProgressReporter) Progress(p TaskPoolProgress) {
+	sec := (p.Elapsed - r.last.Elapsed).Seconds()
+	blkPerSec := float64(p.NumBlocks-r.last.NumBlocks) / sec
+	txPerSec := float64(p.NumTxs-r.last.NumTxs) / sec
+	gasPerSec := float64(p.Gas-r.last.Gas) / sec
+	fmt.Fprintf(r.w, "%s: elapsed time: %v, number = %v\n", p.Name, p.Elapsed.Round(1*time.Millisecond), p.Watermark)
+	fmt.Fprintf(r.w, "%s: %.2f blk/s, %.2f tx/s, %.2f Mgas/s\n", p.Name, blkPerSec, txPerSec, gasPerSec/1e6)
+	r.last = p
+}
+
+func (r *printProgressReporter) Finish(p TaskPoolProgress) {
+	sec := p.Elapsed.Seconds()
+	blkPerSec := float64(p.NumBlocks) / sec
+	txPerSec := float64(p.NumTxs) / sec
+	gasPerSec := float64(p.Gas) / sec
+	fmt.Fprintf(r.w, "%s: block range = %v %v\n", p.Name, p.First, p.Last)
+	fmt.Fprintf(r.w, "%s: total #block = %v\n", p.Name, p.NumBlocks)
+	fmt.Fprintf(r.w, "%s: total #tx    = %v\n", p.Name, p.NumTxs)
+	if p.Sampled {
+		passed := p.Watermark - p.First
+		fmt.Fprintf(r.w, "%s: sample size  = %v of %v blocks (%.2f%%)\n", p.Name, p.NumBlocks, passed, 100*float64(p.NumBlocks)/math.Max(float64(passed), 1))
+	}
+	fmt.Fprintf(r.w, "%s: %.2f blk/s, %.2f tx/s, %.2f Mgas/s\n", p.Name, blkPerSec, txPerSec, gasPerSec/1e6)
+	fmt.Fprintf(r.w, "%s done in %v\n", p.Name, p.Elapsed.Round(1*time.Millisecond))
+}
+
+// SilentProgressReporter is a ProgressReporter which discards all progress.
+type SilentProgressReporter struct{}
+
+func (SilentProgressReporter) Start(TaskPoolProgress)    {}
+func (SilentProgressReporter) Progress(TaskPoolProgress) {}
+func (SilentProgressReporter) Finish(TaskPoolProgress)   {}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xsoniclabs/substate/substate"
+)
+
+type recordingProgressReporter struct {
+	start    []TaskPoolProgress
+	progress []TaskPoolProgress
+	finish   []TaskPoolProgress
+}
+
+func (r *recordingProgressReporter) Start(p TaskPoolProgress)    { r.start = append(r.start, p) }
+func (r *recordingProgressReporter) Progress(p TaskPoolProgress) { r.progress = append(r.progress, p) }
+func (r *recordingProgressReporter) Finish(p TaskPoolProgress)   { r.finish = append(r.finish, p) }
+
+func TestSubstateTaskPool_ExecuteReportsProgress(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add one more substate
+	if err = addSubstate(db, testSubstate.Block+1); err != nil {
+		t.Fatal(err)
+	}
+
+	reporter := new(recordingProgressReporter)
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			return nil
+		},
+
+		First: testSubstate.Block,
+		Last:  testSubstate.Block + 1,
+
+		Workers:  1,
+		Progress: reporter,
+		DB:       db,
+	}
+
+	require.NoError(t, stPool.Execute())
+	require.Len(t, reporter.start, 1)
+	require.Equal(t, testSubstate.Block, reporter.start[0].Watermark)
+	require.Equal(t, 1, reporter.start[0].Workers)
+
+	// last block is always reported
+	require.NotEmpty(t, reporter.progress)
+	require.Equal(t, testSubstate.Block+1, reporter.progress[len(reporter.progress)-1].Watermark)
+
+	require.Len(t, reporter.finish, 1)
+	require.False(t, reporter.finish[0].Sampled)
+	final := reporter.finish[0]
+	require.Equal(t, "test", final.Name)
+	require.Equal(t, testSubstate.Block, final.First)
+	require.Equal(t, testSubstate.Block+1, final.Last)
+	require.Equal(t, testSubstate.Block+2, final.Watermark)
+	require.Equal(t, int64(2), final.NumBlocks)
+	require.Equal(t, int64(2), final.NumTxs)
+	require.Equal(t, int64(2*testSubstate.Result.GasUsed), final.Gas)
+}
+
+func TestPrintProgressReporter(t *testing.T) {
+	out := new(bytes.Buffer)
+	r := NewPrintProgressReporter(out)
+
+	p := TaskPoolProgress{Name: "test", First: 1, Last: 10, Workers: 2, Watermark: 1}
+	r.Start(p)
+	p.Watermark, p.Elapsed, p.NumBlocks, p.NumTxs, p.Gas = 5, time.Second, 4, 8, 2e6
+	r.Progress(p)
+	p.Watermark, p.Elapsed, p.NumBlocks, p.NumTxs, p.Gas = 11, 2*time.Second, 10, 20, 4e6
+	r.Finish(p)
+
+	want := []string{
+		"test: block range = 1 10",
+		"test: #CPU = ",
+		"test: elapsed time: 1s, number = 5",
+		"test: 4.00 blk/s, 8.00 tx/s, 2.00 Mgas/s",
+		"test: block range = 1 10",
+		"test: total #block = 10",
+		"test: total #tx    = 20",
+		"test: 5.00 blk/s, 10.00 tx/s, 2.00 Mgas/s",
+		"test done in 2s",
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, len(want))
+	for i, line := range lines {
+		require.True(t, strings.HasPrefix(line, want[i]), "line %d: got %q, want %q", i, line, want[i])
+	}
+}
+
+func TestPrintProgressReporter_Sampled(t *testing.T) {
+	out := new(bytes.Buffer)
+	r := NewPrintProgressReporter(out)
+
+	p := TaskPoolProgress{Name: "test", First: 1, Last: 100, Sampled: true, Watermark: 101, Elapsed: time.Second, NumBlocks: 10}
+	r.Finish(p)
+	require.Contains(t, out.String(), "test: sample size  = 10 of 100 blocks (10.00%)\n")
+}
+
+func TestSilentProgressReporter(t *testing.T) {
+	var r ProgressReporter = SilentProgressReporter{}
+	r.Start(TaskPoolProgress{})
+	r.Progress(TaskPoolProgress{})
+	r.Finish(TaskPoolProgress{})
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// SubstateCodec compresses substate records. The ID of the codec is stored in the header
+// of every compressed record, hence readers decompress records transparently as long as
+// the codec is registered with RegisterSubstateCodec. Codecs must be safe for concurrent use.
+type SubstateCodec interface {
+	// ID identifies the codec in record headers; 0 is reserved.
+	ID() byte
+
+	// Name identifies the codec in configuration, e.g. "zstd".
+	Name() string
+
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// IDs of built-in codecs. IDs below 16 are reserved for built-in codecs.
+const (
+	SnappyCodecID byte = 1
+	ZstdCodecID   byte = 2
+)
+
+var (
+	substateCodecsMutex sync.RWMutex
+	substateCodecs      = map[byte]SubstateCodec{}
+)
+
+func init() {
+	zstdCodec, err := NewZstdCodec(ZstdCodecID, "zstd", nil)
+	if err != nil {
+		panic(err)
+	}
+	for _, codec := range []SubstateCodec{snappyCodec{}, zstdCodec} {
+		if err = RegisterSubstateCodec(codec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterSubstateCodec makes codec available for reading and writing substate records.
+// It fails if another codec with the same ID or name is registered.
+func RegisterSubstateCodec(codec SubstateCodec) error {
+	if codec.ID() == 0 {
+		return fmt.Errorf("cannot register substate codec %v; id 0 is reserved", codec.Name())
+	}
+
+	substateCodecsMutex.Lock()
+	defer substateCodecsMutex.Unlock()
+	for _, registered := range substateCodecs {
+		if registered.ID() == codec.ID() || registered.Name() == codec.Name() {
+			return fmt.Errorf("cannot register substate codec %v (id %v); conflicts with %v (id %v)", codec.Name(), codec.ID(), registered.Name(), registered.ID())
+		}
+	}
+	substateCodecs[codec.ID()] = codec
+	return nil
+}
+
+// GetSubstateCodec returns the registered codec of given name.
+func GetSubstateCodec(name string) (SubstateCodec, error) {
+	substateCodecsMutex.RLock()
+	defer substateCodecsMutex.RUnlock()
+	for _, codec := range substateCodecs {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("substate codec not supported: %s", name)
+}
+
+// substateCodecByID returns the registered codec of given id.
+func substateCodecByID(id byte) (SubstateCodec, bool) {
+	substateCodecsMutex.RLock()
+	defer substateCodecsMutex.RUnlock()
+	codec, ok := substateCodecs[id]
+	return codec, ok
+}
+
+// snappyCodec compresses records with snappy; it is fast but compresses less than zstd.
+type snappyCodec struct{}
+
+func (snappyCodec) ID() byte {
+	return SnappyCodecID
+}
+
+func (snappyCodec) Name() string {
+	return "snappy"
+}
+
+func (snappyCodec) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCodec) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// zstdDictMagic starts dictionaries in the format produced by "zstd --train".
+var zstdDictMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+type zstdCodec struct {
+	id      byte
+	name    string
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewZstdCodec returns a zstd codec with given id and name. If dict is not empty, records
+// are compressed with the dictionary, which considerably improves the compression of small
+// records. dict is either a dictionary trained by "zstd --train" or raw content such as
+// returned by NewSubstateDictionary. Readers must register a codec with the same id and
+// dictionary to decompress records written with it.
+func NewZstdCodec(id byte, name string, dict []byte) (SubstateCodec, error) {
+	var (
+		eopts = []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		dopts = []zstd.DOption{zstd.WithDecoderConcurrency(0)}
+	)
+	switch {
+	case len(dict) == 0:
+	case bytes.HasPrefix(dict, zstdDictMagic):
+		eopts = append(eopts, zstd.WithEncoderDict(dict))
+		dopts = append(dopts, zstd.WithDecoderDicts(dict))
+	default:
+		eopts = append(eopts, zstd.WithEncoderDictRaw(uint32(id), dict))
+		dopts = append(dopts, zstd.WithDecoderDictRaw(uint32(id), dict))
+	}
+
+	encoder, err := zstd.NewWriter(nil, eopts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create zstd encoder; %w", err)
+	}
+	decoder, err := zstd.NewReader(nil, dopts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create zstd decoder; %w", err)
+	}
+	return &zstdCodec{id: id, name: name, encoder: encoder, decoder: decoder}, nil
+}
+
+func (c *zstdCodec) ID() byte {
+	return c.id
+}
+
+func (c *zstdCodec) Name() string {
+	return c.name
+}
+
+func (c *zstdCodec) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCodec) Decompress(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
+
+// NewSubstateDictionary builds a raw zstd dictionary of at most size bytes from sample
+// records, e.g. records of blocks selected by a BlockSampler. Content common to many
+// records, such as addresses and code hashes of popular contracts, is thus compressed
+// by a reference into the dictionary. Later samples are placed at the end of the
+// dictionary, where references are shortest.
+func NewSubstateDictionary(samples [][]byte, size int) []byte {
+	// take samples from the end until the dictionary is full
+	first, free := len(samples), size
+	for first > 0 && free > 0 {
+		first--
+		free -= len(samples[first])
+	}
+
+	dict := make([]byte, 0, size)
+	for i := first; i < len(samples); i++ {
+		sample := samples[i]
+		if i == first && free < 0 {
+			sample = sample[-free:]
+		}
+		dict = append(dict, sample...)
+	}
+	return dict
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubstateCodec_CompressedRecordsRoundTrip(t *testing.T) {
+	for _, encoding := range []string{"rlp", "protobuf"} {
+		for _, compression := range []string{"none", "snappy", "zstd"} {
+			t.Run(encoding+"_"+compression, func(t *testing.T) {
+				db := createTestSubstateDB(t, encoding, 1, 0, 0)
+				require.NoError(t, db.SetSubstateCompression(compression))
+				require.Equal(t, compression, db.GetSubstateCompression())
+
+				want := newTestSubstate(1, 1)
+				require.NoError(t, db.PutSubstate(want))
+
+				record, err := db.Get(SubstateDBKey(1, 1))
+				require.NoError(t, err)
+				require.Equal(t, SubstateRecordMagic, record[0])
+				require.Equal(t, compression != "none", record[1]&SubstateRecordCompressed != 0)
+
+				got, err := db.GetSubstate(1, 1)
+				require.NoError(t, err)
+				require.NoError(t, want.Equal(got))
+			})
+		}
+	}
+}
+
+func TestSubstateCodec_CompressedRecordsDecodeRegardlessOfCompression(t *testing.T) {
+	db := createTestSubstateDB(t, "rlp", 1, 0, 0)
+	require.NoError(t, db.SetSubstateCompression("zstd"))
+	want := newTestSubstate(1, 0)
+	require.NoError(t, db.PutSubstate(want))
+
+	// neither disabling compression nor changing the codec affects reading
+	for _, compression := range []string{"none", "snappy"} {
+		require.NoError(t, db.SetSubstateCompression(compression))
+		got, err := db.GetSubstate(1, 0)
+		require.NoError(t, err)
+		require.NoError(t, want.Equal(got))
+	}
+	require.Equal(t, "rlp", probeSubstateEncoding(mustGet(t, db, SubstateDBKey(1, 0))))
+}
+
+func TestSubstateCodec_CompressionIsKeptWhenChangingEncoding(t *testing.T) {
+	db := createTestSubstateDB(t, "", 1, 0, 0)
+	require.NoError(t, db.SetSubstateCompression("snappy"))
+	_, err := db.SetSubstateEncoding("protobuf")
+	require.NoError(t, err)
+	require.Equal(t, "snappy", db.GetSubstateCompression())
+}
+
+func TestSubstateCodec_UnknownCodec(t *testing.T) {
+	db := createTestSubstateDB(t, "rlp", 1, 0, 0)
+	require.ErrorContains(t, db.SetSubstateCompression("lz4"), "substate codec not supported")
+
+	record := []byte{SubstateRecordMagic, SubstateRecordRLP | SubstateRecordCompressed, 0xff}
+	_, err := db.decodeToSubstate(record, 1, 0)
+	require.ErrorContains(t, err, "unknown record codec 255")
+}
+
+func TestSubstateCodec_RegisterRejectsConflicts(t *testing.T) {
+	codec, err := NewZstdCodec(ZstdCodecID, "zstd-2", nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, RegisterSubstateCodec(codec), "conflicts with zstd")
+
+	codec, err = NewZstdCodec(0, "zstd-0", nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, RegisterSubstateCodec(codec), "id 0 is reserved")
+}
+
+func TestSubstateCodec_ZstdDictionary(t *testing.T) {
+	var samples [][]byte
+	for tx := 0; tx < 10; tx++ {
+		record, err := encodeRlp(newTestSubstate(1, tx), 1, tx)
+		require.NoError(t, err)
+		samples = append(samples, record)
+	}
+	dict := NewSubstateDictionary(samples, 1000)
+	require.Len(t, dict, 1000)
+	require.Equal(t, samples[len(samples)-1], dict[len(dict)-len(samples[len(samples)-1]):])
+
+	registerTestCodec(t, 100, "zstd-test-dict", dict)
+
+	db := createTestSubstateDB(t, "rlp", 1, 0, 0)
+	require.NoError(t, db.SetSubstateCompression("zstd-test-dict"))
+	want := newTestSubstate(2, 3)
+	require.NoError(t, db.PutSubstate(want))
+
+	record := mustGet(t, db, SubstateDBKey(2, 3))
+	require.Equal(t, byte(100), record[SubstateRecordHeaderSize])
+	got, err := db.GetSubstate(2, 3)
+	require.NoError(t, err)
+	require.NoError(t, want.Equal(got))
+}
+
+func TestSubstateCodec_ConvertCompressesRecords(t *testing.T) {
+	src := createTestSubstateDB(t, "rlp", 1, 5, 2)
+	dst := createTestSubstateDB(t, "", 1, 0, 0)
+
+	_, err := ConvertSubstateEncoding(src, dst, ConvertConfig{Encoding: "protobuf", Compression: "zstd"})
+	require.NoError(t, err)
+
+	record := mustGet(t, dst, SubstateDBKey(1, 0))
+	require.Equal(t, SubstateRecordProtobuf|SubstateRecordCompressed, record[1])
+	require.Equal(t, ZstdCodecID, record[SubstateRecordHeaderSize])
+	requireSameSubstates(t, src, dst, 1, 5, 2)
+}
+
+// registerTestCodec registers a zstd codec unless it was registered by a previous test run.
+func registerTestCodec(tb testing.TB, id byte, name string, dict []byte) SubstateCodec {
+	if codec, err := GetSubstateCodec(name); err == nil {
+		return codec
+	}
+	codec, err := NewZstdCodec(id, name, dict)
+	require.NoError(tb, err)
+	require.NoError(tb, RegisterSubstateCodec(codec))
+	return codec
+}
+
+func mustGet(t *testing.T, db *substateDB, key []byte) []byte {
+	value, err := db.Get(key)
+	require.NoError(t, err)
+	return value
+}
+
+// newBenchmarkSubstates returns substates touching a limited set of popular accounts,
+// so records share content as substates of real blocks do.
+func newBenchmarkSubstates(n int) []*substate.Substate {
+	r := rand.New(rand.NewSource(1))
+	accounts := make([]types.Address, 64)
+	for i := range accounts {
+		r.Read(accounts[i][:])
+	}
+	code := make([]byte, 2048)
+	r.Read(code)
+
+	worldState := func() substate.WorldState {
+		ws := substate.NewWorldState()
+		for i := 0; i < 8; i++ {
+			acc := substate.NewAccount(r.Uint64()%1000, big.NewInt(r.Int63()), code[:r.Intn(len(code))])
+			for j := 0; j < 8; j++ {
+				acc.Storage[types.BigToHash(big.NewInt(int64(r.Intn(32))))] = types.BigToHash(big.NewInt(r.Int63()))
+			}
+			ws[accounts[r.Intn(len(accounts))]] = acc
+		}
+		return ws
+	}
+
+	substates := make([]*substate.Substate, n)
+	for i := range substates {
+		ss := *newTestSubstate(uint64(i/4+1), i%4)
+		ss.InputSubstate = worldState()
+		ss.OutputSubstate = worldState()
+		substates[i] = &ss
+	}
+	return substates
+}
+
+// BenchmarkSubstateEncoding compares record size and decode time of the encodings with
+// and without compression. Each op decodes a single record; its average size is reported
+// in B/record. The dictionary is built from records other than the decoded ones.
+func BenchmarkSubstateEncoding(b *testing.B) {
+	substates := newBenchmarkSubstates(256)
+	lookup := func(types.Hash) ([]byte, error) { return nil, nil }
+
+	for i, schema := range []string{"rlp", "protobuf"} {
+		plain, err := newSubstateEncoding(schema, lookup)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var samples [][]byte
+		for _, ss := range substates[:len(substates)/2] {
+			record, err := plain.payload(ss, ss.Block, ss.Transaction)
+			if err != nil {
+				b.Fatal(err)
+			}
+			samples = append(samples, record)
+		}
+		dictCodec := registerTestCodec(b, byte(200+i), "zstd-dict-"+schema, NewSubstateDictionary(samples, 64*1024))
+
+		for _, codec := range []SubstateCodec{nil, snappyCodec{}, mustGetCodec(b, "zstd"), dictCodec} {
+			name := "none"
+			if codec != nil {
+				name = codec.Name()
+			}
+			encoding := plain.withCodec(codec)
+
+			// records of substates not used as dictionary samples
+			var records [][]byte
+			size := 0
+			for _, ss := range substates[len(substates)/2:] {
+				record, err := encoding.encode(ss, ss.Block, ss.Transaction)
+				if err != nil {
+					b.Fatal(err)
+				}
+				records = append(records, record)
+				size += len(record)
+			}
+
+			b.Run(fmt.Sprintf("%v/%v", schema, name), func(b *testing.B) {
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					record := records[i%len(records)]
+					if _, err := encoding.decode(record, 1, 0); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(size)/float64(len(records)), "B/record")
+			})
+		}
+	}
+}
+
+func mustGetCodec(b *testing.B, name string) SubstateCodec {
+	codec, err := GetSubstateCodec(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return codec
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	ConvertCheckpointKey = MetadataPrefix + "cv" // last source key copied by ConvertSubstateEncoding
+
+	defaultConvertBatchSize = 64 * 1024 * 1024
+)
+
+// ConvertConfig contains options of ConvertSubstateEncoding.
+type ConvertConfig struct {
+	Encoding    string // encoding of converted substates, e.g. "rlp" or "protobuf"
+	Compression string // registered codec compressing converted substates, e.g. "zstd"; "" and "none" disable compression
+	BatchSize   int    // number of bytes buffered before they are written into the target; 64 MiB if not positive
+}
+
+// ConvertStats counts the records copied by ConvertSubstateEncoding.
+type ConvertStats struct {
+	Codes     int64
+	Substates int64
+}
+
+// ConvertSubstateEncoding copies every code and substate of src into dst. Substates are
+// decoded with the encoding of src and re-encoded with cfg.Encoding and cfg.Compression.
+// Every converted substate is decoded again and must be equal to the source substate,
+// otherwise the conversion fails.
+//
+// Records are written in batches together with the last copied source key, hence an
+// interrupted conversion resumes after it when called again. Codes are copied again on
+// resume unless the conversion was interrupted while copying codes, so codes of substates
+// added to src meanwhile are never missing.
+func ConvertSubstateEncoding(src, dst SubstateDB, cfg ConvertConfig) (ConvertStats, error) {
+	var stats ConvertStats
+
+	source, err := newSubstateEncoding(src.GetSubstateEncoding(), src.GetCode)
+	if err != nil {
+		return stats, fmt.Errorf("cannot convert substates; %w", err)
+	}
+	target, err := newSubstateEncoding(cfg.Encoding, dst.GetCode)
+	if err != nil {
+		return stats, fmt.Errorf("cannot convert substates; %w", err)
+	}
+	if cfg.Compression != "" && cfg.Compression != "none" {
+		codec, err := GetSubstateCodec(cfg.Compression)
+		if err != nil {
+			return stats, fmt.Errorf("cannot convert substates; %w", err)
+		}
+		target = target.withCodec(codec)
+	}
+	if _, err = dst.SetSubstateEncoding(target.schema); err != nil {
+		return stats, fmt.Errorf("cannot convert substates; %w", err)
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultConvertBatchSize
+	}
+
+	checkpoint, err := dst.Get([]byte(ConvertCheckpointKey))
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		return stats, fmt.Errorf("cannot get conversion checkpoint; %w", err)
+	}
+
+	batch := dst.NewBatch()
+	if err = batch.Put([]byte(SubstateEncodingKey), []byte(target.schema)); err != nil {
+		return stats, err
+	}
+	var lastKey []byte
+	flush := func() error {
+		if lastKey != nil {
+			if err := batch.Put([]byte(ConvertCheckpointKey), lastKey); err != nil {
+				return err
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return fmt.Errorf("cannot write batch; %w", err)
+		}
+		batch.Reset()
+		return nil
+	}
+
+	// copy codes
+	iter := src.NewIterator([]byte(CodeDBPrefix), resumeStart(checkpoint, CodeDBPrefix))
+	for iter.Next() {
+		if err = batch.Put(iter.Key(), iter.Value()); err != nil {
+			iter.Release()
+			return stats, err
+		}
+		stats.Codes++
+		lastKey = append(lastKey[:0], iter.Key()...)
+		if batch.ValueSize() >= batchSize {
+			if err = flush(); err != nil {
+				iter.Release()
+				return stats, err
+			}
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return stats, fmt.Errorf("cannot iterate codes; %w", err)
+	}
+	// codes must be written before converted substates are verified
+	if err = flush(); err != nil {
+		return stats, err
+	}
+
+	// convert substates
+	iter = src.NewIterator([]byte(SubstateDBPrefix), resumeStart(checkpoint, SubstateDBPrefix))
+	defer iter.Release()
+	for iter.Next() {
+		block, tx, err := DecodeSubstateDBKey(iter.Key())
+		if err != nil {
+			return stats, fmt.Errorf("invalid substate key: %v; %w", iter.Key(), err)
+		}
+
+		ss, err := source.decode(iter.Value(), block, tx)
+		if err != nil {
+			return stats, err
+		}
+		value, err := target.encode(ss, block, tx)
+		if err != nil {
+			return stats, err
+		}
+		converted, err := target.decode(value, block, tx)
+		if err != nil {
+			return stats, err
+		}
+		if err = ss.Equal(converted); err != nil {
+			return stats, fmt.Errorf("substate block: %v, tx: %v differs after conversion; %w", block, tx, err)
+		}
+
+		if err = batch.Put(iter.Key(), value); err != nil {
+			return stats, err
+		}
+		stats.Substates++
+		lastKey = append(lastKey[:0], iter.Key()...)
+		if batch.ValueSize() >= batchSize {
+			if err = flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err = iter.Error(); err != nil {
+		return stats, fmt.Errorf("cannot iterate substates; %w", err)
+	}
+
+	return stats, flush()
+}
+
+// resumeStart returns the iterator start within prefix following the checkpointed key,
+// or nil if the checkpoint is not within prefix.
+func resumeStart(checkpoint []byte, prefix string) []byte {
+	if !bytes.HasPrefix(checkpoint, []byte(prefix)) {
+		return nil
+	}
+	return append(bytes.Clone(checkpoint[len(prefix):]), 0)
+}
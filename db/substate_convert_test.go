@@ -0,0 +1,75 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireSameSubstates(t *testing.T, want, got SubstateDB, first, last uint64, txsPerBlock int) {
+	for block := first; block <= last; block++ {
+		for tx := 0; tx < txsPerBlock; tx++ {
+			w, err := want.GetSubstate(block, tx)
+			require.NoError(t, err)
+			g, err := got.GetSubstate(block, tx)
+			require.NoError(t, err)
+			require.NoError(t, w.Equal(g))
+		}
+	}
+}
+
+func TestConvertSubstateEncoding_RlpToProtobufAndBack(t *testing.T) {
+	src := createTestSubstateDB(t, "rlp", 1, 10, 4)
+
+	pbDB, err := newSubstateDB(t.TempDir()+"pb-db", nil, nil, nil)
+	require.NoError(t, err)
+	stats, err := ConvertSubstateEncoding(src, pbDB, ConvertConfig{Encoding: "protobuf", BatchSize: 1024})
+	require.NoError(t, err)
+	require.Equal(t, int64(40), stats.Substates)
+	require.NotZero(t, stats.Codes)
+	require.Equal(t, "protobuf", pbDB.GetSubstateEncoding())
+
+	value, err := pbDB.Get(SubstateDBKey(1, 0))
+	require.NoError(t, err)
+	require.Equal(t, SubstateRecordProtobuf, value[1])
+	requireSameSubstates(t, src, pbDB, 1, 10, 4)
+
+	rlpDB, err := newSubstateDB(t.TempDir()+"rlp-db", nil, nil, nil)
+	require.NoError(t, err)
+	stats, err = ConvertSubstateEncoding(pbDB, rlpDB, ConvertConfig{Encoding: "rlp"})
+	require.NoError(t, err)
+	require.Equal(t, int64(40), stats.Substates)
+	requireSameSubstates(t, src, rlpDB, 1, 10, 4)
+}
+
+func TestConvertSubstateEncoding_Resumes(t *testing.T) {
+	src := createTestSubstateDB(t, "rlp", 1, 10, 4)
+	dst, err := newSubstateDB(t.TempDir()+"dst-db", nil, nil, nil)
+	require.NoError(t, err)
+
+	// interrupted after the substates of block 5
+	require.NoError(t, dst.Put([]byte(ConvertCheckpointKey), SubstateDBKey(5, 3)))
+	stats, err := ConvertSubstateEncoding(src, dst, ConvertConfig{Encoding: "protobuf"})
+	require.NoError(t, err)
+	require.Equal(t, int64(20), stats.Substates)
+
+	has, err := dst.HasSubstate(5, 3)
+	require.NoError(t, err)
+	require.False(t, has)
+	requireSameSubstates(t, src, dst, 6, 10, 4)
+
+	// completed conversion only converts substates added meanwhile
+	require.NoError(t, src.PutSubstate(newTestSubstate(11, 0)))
+	stats, err = ConvertSubstateEncoding(src, dst, ConvertConfig{Encoding: "protobuf"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), stats.Substates)
+	requireSameSubstates(t, src, dst, 11, 11, 1)
+}
+
+func TestConvertSubstateEncoding_MismatchingTargetEncoding(t *testing.T) {
+	src := createTestSubstateDB(t, "rlp", 1, 1, 1)
+	dst := createTestSubstateDB(t, "rlp", 1, 1, 1)
+
+	_, err := ConvertSubstateEncoding(src, dst, ConvertConfig{Encoding: "protobuf"})
+	require.ErrorIs(t, err, ErrSubstateEncodingMismatch)
+}
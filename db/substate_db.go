@@ -2,7 +2,10 @@ package db
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/0xsoniclabs/substate/substate"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -34,19 +37,36 @@ type SubstateDB interface {
 
 	NewSubstateIterator(start int, numWorkers int) Iterator[*substate.Substate]
 
+	// NewSubstateRangeIterator returns iterator which iterates over Substates within given range.
+	// The underlying iterator stops at the range bound, hence nothing past it is read or decoded.
+	// Substates of blocks not selected by the range's Sampler are skipped without being decoded.
+	NewSubstateRangeIterator(r SubstateRange, numWorkers int) Iterator[*substate.Substate]
+
 	NewSubstateTaskPool(name string, taskFunc SubstateTaskFunc, first, last uint64, ctx *cli.Context) *SubstateTaskPool
 
+	// NewSubstateTaskPoolWithConfig creates a SubstateTaskPool over this DB configured by cfg.
+	NewSubstateTaskPoolWithConfig(name string, taskFunc SubstateTaskFunc, first, last uint64, cfg TaskPoolConfig) *SubstateTaskPool
+
 	// GetFirstSubstate returns last substate (block and transaction wise) inside given DB.
 	GetFirstSubstate() *substate.Substate
 
 	// GetLastSubstate returns last substate (block and transaction wise) inside given DB.
 	GetLastSubstate() (*substate.Substate, error)
 
-	// SetSubstateEncoding sets the decoder func to the provided encoding
+	// SetSubstateEncoding sets the decoder func to the provided encoding. It fails
+	// with ErrSubstateEncodingMismatch if the db is written with another encoding.
 	SetSubstateEncoding(encoding string) (*substateDB, error)
 
 	// GetSubstateEncoding returns the currently configured encoding
 	GetSubstateEncoding() string
+
+	// SetSubstateCompression compresses written substate records with the registered codec
+	// of given name; "" and "none" disable compression. Compressed records are decompressed
+	// transparently when read.
+	SetSubstateCompression(codec string) error
+
+	// GetSubstateCompression returns the codec compressing written substate records or "none".
+	GetSubstateCompression() string
 }
 
 // NewDefaultSubstateDB creates new instance of SubstateDB with default options.
@@ -60,15 +80,20 @@ func NewSubstateDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.Re
 	return newSubstateDB(path, o, wo, ro)
 }
 
+// NewSubstateDBWithEngine creates new instance of SubstateDB stored in given Engine with default options.
+func NewSubstateDBWithEngine(path string, engine Engine) (SubstateDB, error) {
+	return newSubstateDBWithEngine(path, engine, false)
+}
+
 func MakeDefaultSubstateDB(db *leveldb.DB) SubstateDB {
-	sdb := &substateDB{&codeDB{&baseDB{backend: db}}, nil}
-	sdb, _ = sdb.SetSubstateEncoding("default")
+	sdb := &substateDB{codeDB: &codeDB{&baseDB{backend: newLevelDBBackend(db, nil, nil)}}}
+	sdb.initSubstateEncoding()
 	return sdb
 }
 
 func MakeDefaultSubstateDBFromBaseDB(db BaseDB) SubstateDB {
-	sdb := &substateDB{&codeDB{&baseDB{backend: db.getBackend()}}, nil}
-	sdb, _ = sdb.SetSubstateEncoding("default")
+	sdb := &substateDB{codeDB: &codeDB{&baseDB{backend: db.getBackend()}}}
+	sdb.initSubstateEncoding()
 	return sdb
 }
 
@@ -77,9 +102,14 @@ func NewReadOnlySubstateDB(path string) (SubstateDB, error) {
 	return newSubstateDB(path, &opt.Options{ReadOnly: true}, nil, nil)
 }
 
+// NewReadOnlySubstateDBWithEngine creates a new instance of read-only SubstateDB stored in given Engine.
+func NewReadOnlySubstateDBWithEngine(path string, engine Engine) (SubstateDB, error) {
+	return newSubstateDBWithEngine(path, engine, true)
+}
+
 func MakeSubstateDB(db *leveldb.DB, wo *opt.WriteOptions, ro *opt.ReadOptions) SubstateDB {
-	sdb := &substateDB{&codeDB{&baseDB{backend: db, wo: wo, ro: ro}}, nil}
-	sdb, _ = sdb.SetSubstateEncoding("default")
+	sdb := &substateDB{codeDB: &codeDB{&baseDB{backend: newLevelDBBackend(db, wo, ro)}}}
+	sdb.initSubstateEncoding()
 	return sdb
 }
 
@@ -89,14 +119,37 @@ func newSubstateDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.Re
 		return nil, err
 	}
 
-	sdb := &substateDB{base, nil}
-	sdb, _ = sdb.SetSubstateEncoding("default")
+	sdb := &substateDB{codeDB: base}
+	if _, err = sdb.SetSubstateEncoding("default"); err != nil {
+		return nil, errors.Join(err, base.Close())
+	}
+	return sdb, nil
+}
+
+func newSubstateDBWithEngine(path string, engine Engine, readOnly bool) (*substateDB, error) {
+	base, err := newCodeDBWithEngine(path, engine, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	sdb := &substateDB{codeDB: base}
+	if _, err = sdb.SetSubstateEncoding("default"); err != nil {
+		return nil, errors.Join(err, base.Close())
+	}
 	return sdb, nil
 }
 
 type substateDB struct {
 	*codeDB
-	encoding *substateEncoding
+	encoding       *substateEncoding
+	encodingStored atomic.Bool // SubstateEncodingKey is known to be written
+}
+
+// initSubstateEncoding configures the encoding the db is written with; rlp is used if it cannot be determined.
+func (db *substateDB) initSubstateEncoding() {
+	if _, err := db.SetSubstateEncoding("default"); err != nil {
+		db.encoding, _ = newSubstateEncoding("rlp", db.GetCode)
+	}
 }
 
 func (db *substateDB) GetFirstSubstate() *substate.Substate {
@@ -127,13 +180,18 @@ func (db *substateDB) GetSubstate(block uint64, tx int) (*substate.Substate, err
 
 // GetBlockSubstates returns substates for given block if exists within DB.
 func (db *substateDB) GetBlockSubstates(block uint64) (map[int]*substate.Substate, error) {
+	return db.getBlockSubstates(block, nil)
+}
+
+// getBlockSubstates returns substates of given block recording their decoding into m if it is not nil.
+func (db *substateDB) getBlockSubstates(block uint64, m *Metrics) (map[int]*substate.Substate, error) {
 	var err error
 
 	txSubstate := make(map[int]*substate.Substate)
 
 	prefix := SubstateDBBlockPrefix(block)
 
-	iter := db.backend.NewIterator(util.BytesPrefix(prefix), nil)
+	iter := db.backend.NewIterator(util.BytesPrefix(prefix))
 	for iter.Next() {
 		key := iter.Key()
 		value := iter.Value()
@@ -147,10 +205,12 @@ func (db *substateDB) GetBlockSubstates(block uint64) (map[int]*substate.Substat
 			return nil, fmt.Errorf("record-replay: GetBlockSubstates(%v) iterated substates from block %v", block, b)
 		}
 
+		start := time.Now()
 		sbstt, err := db.decodeToSubstate(value, block, tx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode substate, block %v, tx: %v; %w", block, tx, err)
 		}
+		m.recordDecode(len(value), time.Since(start))
 
 		txSubstate[tx] = sbstt
 	}
@@ -178,6 +238,10 @@ func (db *substateDB) PutSubstate(ss *substate.Substate) error {
 		}
 	}
 
+	if err := db.putSubstateEncoding(); err != nil {
+		return err
+	}
+
 	if msg := ss.Message; msg.To == nil {
 		err := db.PutCode(msg.Data)
 		if err != nil {
@@ -210,23 +274,29 @@ func (db *substateDB) NewSubstateIterator(start int, numWorkers int) Iterator[*s
 	return iter
 }
 
-func (db *substateDB) NewSubstateTaskPool(name string, taskFunc SubstateTaskFunc, first, last uint64, ctx *cli.Context) *SubstateTaskPool {
-	return &SubstateTaskPool{
-		Name:     name,
-		TaskFunc: taskFunc,
-
-		First: first,
-		Last:  last,
+// NewSubstateRangeIterator returns iterator which iterates over Substates within given range.
+func (db *substateDB) NewSubstateRangeIterator(r SubstateRange, numWorkers int) Iterator[*substate.Substate] {
+	iter := newSubstateRangeIterator(db, r.keyRange(), r.Sampler)
 
-		Workers:         ctx.Int(WorkersFlag.Name),
-		SkipTransferTxs: ctx.Bool(SkipTransferTxsFlag.Name),
-		SkipCallTxs:     ctx.Bool(SkipCallTxsFlag.Name),
-		SkipCreateTxs:   ctx.Bool(SkipCreateTxsFlag.Name),
+	iter.start(numWorkers)
 
-		Ctx: ctx,
+	return iter
+}
 
-		DB: db,
+// NewSubstateTaskPool creates a SubstateTaskPool over this DB configured by CLI flags.
+// If the flags are invalid, executing the pool fails with the configuration error.
+func (db *substateDB) NewSubstateTaskPool(name string, taskFunc SubstateTaskFunc, first, last uint64, ctx *cli.Context) *SubstateTaskPool {
+	cfg, err := NewTaskPoolConfigFromCli(ctx)
+	pool := NewSubstateTaskPool(name, taskFunc, first, last, cfg, db)
+	pool.Ctx = ctx
+	if err != nil {
+		pool.configErr = fmt.Errorf("%s: invalid configuration; %w", name, err)
 	}
+	return pool
+}
+
+func (db *substateDB) NewSubstateTaskPoolWithConfig(name string, taskFunc SubstateTaskFunc, first, last uint64, cfg TaskPoolConfig) *SubstateTaskPool {
+	return NewSubstateTaskPool(name, taskFunc, first, last, cfg, db)
 }
 
 // getLongestEncodedKeyZeroPrefixLength returns longest index of biggest block number to be search for in its search
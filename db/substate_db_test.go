@@ -6,10 +6,13 @@ import (
 	"math/big"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/syndtr/goleveldb/leveldb"
 
 	"github.com/0xsoniclabs/substate/substate"
 	"github.com/0xsoniclabs/substate/types"
+	"github.com/0xsoniclabs/substate/types/hash"
+	trlp "github.com/0xsoniclabs/substate/types/rlp"
 )
 
 var testSubstate = &substate.Substate{
@@ -30,49 +33,61 @@ var testSubstate = &substate.Substate{
 }
 
 func TestSubstateDB_PutSubstate(t *testing.T) {
-	dbPath := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(dbPath)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	s := new(leveldb.DBStats)
-	err = db.backend.Stats(s)
-	if err != nil {
-		t.Fatalf("cannot get db stats; %v", err)
-	}
-
-	// 54 is the base write when creating levelDB
-	if s.IOWrite <= 54 {
-		t.Fatal("db file should have something inside")
-	}
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ldb, ok := db.backend.(*levelDBBackend); ok {
+			s := new(leveldb.DBStats)
+			err = ldb.db.Stats(s)
+			if err != nil {
+				t.Fatalf("cannot get db stats; %v", err)
+			}
+
+			// 54 is the base write when creating levelDB
+			if s.IOWrite <= 54 {
+				t.Fatal("db file should have something inside")
+			}
+		}
+
+		if !db.hasKeyValuesFor(nil, nil) {
+			t.Fatal("db should have something inside")
+		}
+	})
 }
 
 func TestSubstateDB_HasSubstate(t *testing.T) {
-	dbPath := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(dbPath)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	has, err := db.HasSubstate(37_534_834, 1)
-	if err != nil {
-		t.Fatalf("has substate returned error; %v", err)
-	}
-
-	if !has {
-		t.Fatal("substate is not within db")
-	}
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		has, err := db.HasSubstate(37_534_834, 1)
+		if err != nil {
+			t.Fatalf("has substate returned error; %v", err)
+		}
+
+		if !has {
+			t.Fatal("substate is not within db")
+		}
+	})
 }
 
 func TestSubstateDB_GetSubstate(t *testing.T) {
-	dbPath := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(dbPath)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	testSubstateDB_GetSubstate(db, t)
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testSubstateDB_GetSubstate(db, t)
+	})
 }
 
 func testSubstateDB_GetSubstate(db *substateDB, t *testing.T) {
@@ -92,107 +107,119 @@ func testSubstateDB_GetSubstate(db *substateDB, t *testing.T) {
 }
 
 func TestSubstateDB_DeleteSubstate(t *testing.T) {
-	dbPath := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(dbPath)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	err = db.DeleteSubstate(37_534_834, 1)
-	if err != nil {
-		t.Fatalf("delete substate returned error; %v", err)
-	}
-
-	ss, err := db.GetSubstate(37_534_834, 1)
-	if err == nil {
-		t.Fatal("get substate must fail")
-	}
-
-	if got, want := err, leveldb.ErrNotFound; !errors.Is(got, want) {
-		t.Fatalf("unexpected err, got: %v, want: %v", got, want)
-	}
-
-	if ss != nil {
-		t.Fatal("substate was not deleted")
-	}
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.DeleteSubstate(37_534_834, 1)
+		if err != nil {
+			t.Fatalf("delete substate returned error; %v", err)
+		}
+
+		ss, err := db.GetSubstate(37_534_834, 1)
+		if err == nil {
+			t.Fatal("get substate must fail")
+		}
+
+		if got, want := err, leveldb.ErrNotFound; !errors.Is(got, want) {
+			t.Fatalf("unexpected err, got: %v, want: %v", got, want)
+		}
+
+		if ss != nil {
+			t.Fatal("substate was not deleted")
+		}
+	})
 }
 
 func TestSubstateDB_getLastBlock(t *testing.T) {
-	dbPath := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(dbPath)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// add one more substate
-	if err = addSubstate(db, testSubstate.Block+1); err != nil {
-		t.Fatal(err)
-	}
-
-	block, err := db.getLastBlock()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if block != 37534835 {
-		t.Fatalf("incorrect block number\ngot: %v\nwant: %v", block, testSubstate.Block+1)
-	}
-
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// add one more substate
+		if err = addSubstate(db, testSubstate.Block+1); err != nil {
+			t.Fatal(err)
+		}
+
+		block, err := db.getLastBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if block != 37534835 {
+			t.Fatalf("incorrect block number\ngot: %v\nwant: %v", block, testSubstate.Block+1)
+		}
+
+	})
 }
 
 func TestSubstateDB_GetFirstSubstate(t *testing.T) {
-	// save data for comparison
-	want := *testSubstate
-	want.Block = 1
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		// save data for comparison
+		want := *testSubstate
+		want.Block = 1
 
-	dbPath := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(dbPath)
-	if err != nil {
-		t.Fatal(err)
-	}
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	// add one more substate
-	if err = addSubstate(db, 2); err != nil {
-		t.Fatal(err)
-	}
+		// add one more substate
+		if err = addSubstate(db, 2); err != nil {
+			t.Fatal(err)
+		}
 
-	got := db.GetFirstSubstate()
+		got := db.GetFirstSubstate()
 
-	if err = got.Equal(&want); err != nil {
-		t.Fatalf("substates are different\nerr: %v\ngot: %s\nwant: %s", err, got, &want)
-	}
+		if err = got.Equal(&want); err != nil {
+			t.Fatalf("substates are different\nerr: %v\ngot: %s\nwant: %s", err, got, &want)
+		}
 
+	})
 }
 
 func TestSubstateDB_GetLastSubstate(t *testing.T) {
-	// save data for comparison
-	want := *testSubstate
-	want.Block = 2
-
-	dbPath := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(dbPath)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// add one more substate
-	if err = addSubstate(db, 2); err != nil {
-		t.Fatal(err)
-	}
-
-	got, err := db.GetLastSubstate()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if err = got.Equal(&want); err != nil {
-		t.Fatalf("substates are different\nerr: %v\ngot: %s\nwant: %s", err, got, &want)
-	}
-
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		// save data for comparison
+		want := *testSubstate
+		want.Block = 2
+
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// add one more substate
+		if err = addSubstate(db, 2); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := db.GetLastSubstate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = got.Equal(&want); err != nil {
+			t.Fatalf("substates are different\nerr: %v\ngot: %s\nwant: %s", err, got, &want)
+		}
+
+	})
 }
 
 func createDbAndPutSubstate(dbPath string) (*substateDB, error) {
-	db, err := newSubstateDB(dbPath, nil, nil, nil)
+	return createDbAndPutSubstateWithEngine(dbPath, LevelDBEngine)
+}
+
+func createDbAndPutSubstateWithEngine(dbPath string, engine Engine) (*substateDB, error) {
+	db, err := newSubstateDBWithEngine(dbPath, engine, false)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open db; %v", err)
 	}
@@ -223,3 +250,79 @@ func addCustomSubstate(db *substateDB, blk uint64, ss *substate.Substate) error
 
 	return db.PutSubstate(&s)
 }
+
+// newTestSubstate returns a substate of given block and tx with code in its world
+// states; odd transactions create a contract.
+func newTestSubstate(block uint64, tx int) *substate.Substate {
+	ss := *testSubstate
+	ss.Block, ss.Transaction = block, tx
+	env := *testSubstate.Env
+	env.Number = block
+	ss.Env = &env
+	ss.InputSubstate = substate.WorldState{
+		types.Address{1}: substate.NewAccount(1, big.NewInt(1), []byte{byte(block), byte(tx)}),
+	}
+	ss.OutputSubstate = substate.WorldState{
+		types.Address{2}: substate.NewAccount(2, big.NewInt(2), []byte{byte(tx), byte(block)}),
+	}
+	msg := *testSubstate.Message
+	msg.Data = []byte{byte(block), byte(tx), 0xff}
+	ss.Message = &msg
+	if tx%2 == 1 {
+		msg.To = nil
+
+		// contract address as derived by the protobuf decoder
+		data, _ := trlp.EncodeToBytes([]interface{}{msg.From, msg.Nonce})
+		res := *testSubstate.Result
+		res.ContractAddress = types.BytesToAddress(hash.Keccak256Hash(data).Bytes()[12:])
+		ss.Result = &res
+	}
+	return &ss
+}
+
+// createTestSubstateDB returns a db written with given encoding holding substates created by
+// newTestSubstate for txsPerBlock transactions of blocks first to last, and given codes not
+// referenced by any substate. The db holds no substates if last is before first.
+func createTestSubstateDB(t *testing.T, encoding string, first, last uint64, txsPerBlock int, codes ...[]byte) *substateDB {
+	db, err := newSubstateDB(t.TempDir()+"test-db", nil, nil, nil)
+	require.NoError(t, err)
+	_, err = db.SetSubstateEncoding(encoding)
+	require.NoError(t, err)
+	for block := first; block <= last; block++ {
+		for tx := 0; tx < txsPerBlock; tx++ {
+			require.NoError(t, db.PutSubstate(newTestSubstate(block, tx)))
+		}
+	}
+	for _, code := range codes {
+		require.NoError(t, db.PutCode(code))
+	}
+	return db
+}
+
+func TestSubstateDB_GetBlockSubstates(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		dbPath := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(dbPath, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// add one more substate
+		if err = addSubstate(db, testSubstate.Block+1); err != nil {
+			t.Fatal(err)
+		}
+
+		substates, err := db.GetBlockSubstates(testSubstate.Block)
+		if err != nil {
+			t.Fatalf("get block substates returned error; %v", err)
+		}
+
+		if len(substates) != 1 {
+			t.Fatalf("incorrect number of substates\ngot: %v\nwant: %v", len(substates), 1)
+		}
+
+		if err = substates[testSubstate.Transaction].Equal(testSubstate); err != nil {
+			t.Fatalf("substates are different; %v", err)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 
 	pb "github.com/0xsoniclabs/substate/protobuf"
@@ -9,24 +10,125 @@ import (
 	"github.com/0xsoniclabs/substate/types"
 	trlp "github.com/0xsoniclabs/substate/types/rlp"
 	"github.com/golang/protobuf/proto"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// SubstateEncodingKey stores the encoding of substate records; it is written on first PutSubstate.
+const SubstateEncodingKey = MetadataPrefix + "se"
+
+// ErrSubstateEncodingMismatch is returned when requesting an encoding other than the one the db is written with.
+var ErrSubstateEncodingMismatch = errors.New("substate encoding mismatch")
+
 // SetSubstateEncoding sets the runtime encoding/decoding behavior of substateDB
 // intended usage:
 //
-//	db := &substateDB{..} // default to rlp
+//	db := &substateDB{..} // default to encoding the db is written with, rlp if empty
 //	     db, err := db.SetSubstateEncoding(<schema>) // set encoding
 //	     db.GetSubstateDecoder() // returns configured encoding
+//
+// "" and "default" select the encoding the db is written with. Requesting any other
+// encoding than the stored one returns ErrSubstateEncodingMismatch.
 func (db *substateDB) SetSubstateEncoding(schema string) (*substateDB, error) {
+	stored, err := db.storedSubstateEncoding()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set decoder; %w", err)
+	}
+	if schema == "" || schema == "default" {
+		schema = stored
+	}
+
 	encoding, err := newSubstateEncoding(schema, db.GetCode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to set decoder; %w", err)
 	}
+	if stored != "" && stored != encoding.schema {
+		return nil, fmt.Errorf("failed to set decoder; %w: requested %v, db is encoded with %v", ErrSubstateEncodingMismatch, encoding.schema, stored)
+	}
+	if db.encoding != nil {
+		encoding = encoding.withCodec(db.encoding.codec)
+	}
 
 	db.encoding = encoding
 	return db, nil
 }
 
+// SetSubstateCompression compresses substate records written from now on with the registered
+// codec of given name; "" and "none" disable compression. Records are always read regardless
+// of their compression, hence the compression of a db may be changed at any time.
+func (db *substateDB) SetSubstateCompression(name string) error {
+	var codec SubstateCodec
+	if name != "" && name != "none" {
+		var err error
+		if codec, err = GetSubstateCodec(name); err != nil {
+			return fmt.Errorf("failed to set compression; %w", err)
+		}
+	}
+	db.encoding = db.encoding.withCodec(codec)
+	return nil
+}
+
+// GetSubstateCompression returns the name of the codec compressing written records or "none".
+func (db *substateDB) GetSubstateCompression() string {
+	if db.encoding == nil || db.encoding.codec == nil {
+		return "none"
+	}
+	return db.encoding.codec.Name()
+}
+
+// storedSubstateEncoding returns the encoding the db is written with or "" if the db is empty.
+// It reads SubstateEncodingKey and falls back to probing the first substate record.
+func (db *substateDB) storedSubstateEncoding() (string, error) {
+	schema, err := db.Get([]byte(SubstateEncodingKey))
+	if err == nil {
+		return string(schema), nil
+	}
+	if !errors.Is(err, leveldb.ErrNotFound) {
+		return "", fmt.Errorf("cannot get substate encoding; %w", err)
+	}
+
+	iter := db.backend.NewIterator(util.BytesPrefix([]byte(SubstateDBPrefix)))
+	defer iter.Release()
+	if !iter.Next() {
+		return "", iter.Error()
+	}
+	return probeSubstateEncoding(iter.Value()), nil
+}
+
+// probeSubstateEncoding returns the encoding of a substate record. Records without header
+// are either RLP lists, which start with a byte of at least 0xc0, or protobuf messages.
+func probeSubstateEncoding(record []byte) string {
+	if len(record) >= SubstateRecordHeaderSize && record[0] == SubstateRecordMagic {
+		if record[1]&^SubstateRecordCompressed == SubstateRecordProtobuf {
+			return "protobuf"
+		}
+		return "rlp"
+	}
+	if len(record) > 0 && record[0] < 0xc0 {
+		return "protobuf"
+	}
+	return "rlp"
+}
+
+// putSubstateEncoding records the encoding in use unless the db already stores one.
+func (db *substateDB) putSubstateEncoding() error {
+	if db.encodingStored.Load() {
+		return nil
+	}
+
+	has, err := db.Has([]byte(SubstateEncodingKey))
+	if err != nil {
+		return fmt.Errorf("cannot get substate encoding; %w", err)
+	}
+	if !has {
+		if err = db.Put([]byte(SubstateEncodingKey), []byte(db.encoding.schema)); err != nil {
+			return fmt.Errorf("cannot put substate encoding; %w", err)
+		}
+	}
+	db.encodingStored.Store(true)
+	return nil
+}
+
 // GetDecoder returns the encoding in use
 func (db *substateDB) GetSubstateEncoding() string {
 	if db.encoding == nil {
@@ -36,9 +138,46 @@ func (db *substateDB) GetSubstateEncoding() string {
 }
 
 type substateEncoding struct {
-	schema string
-	decode decodeFunc
-	encode encodeFunc
+	schema  string
+	version byte          // schema version written into record headers
+	payload encodeFunc    // encodes records without header
+	codec   SubstateCodec // compresses written records; nil if records are not compressed
+	decode  decodeFunc
+	encode  encodeFunc
+}
+
+// withCodec returns a copy of the encoding writing records compressed by codec.
+func (e *substateEncoding) withCodec(codec SubstateCodec) *substateEncoding {
+	compressed := *e
+	compressed.codec = codec
+	compressed.encode = withRecordHeader(e.version, e.payload, codec)
+	return &compressed
+}
+
+const (
+	// SubstateRecordMagic is the first byte of every substate record written with a header.
+	// It neither starts an RLP list nor a valid protobuf field tag (wire type 6),
+	// hence records written without header are never mistaken for tagged ones.
+	SubstateRecordMagic byte = 0x5e
+
+	// SubstateRecordHeaderSize is the size of the header: magic byte and schema version.
+	// Compressed records carry the ID of their codec in an additional header byte.
+	SubstateRecordHeaderSize = 2
+
+	// SubstateRecordCompressed is set in the schema version of compressed records.
+	SubstateRecordCompressed byte = 0x80
+)
+
+// Schema versions of substate records stored in the second header byte.
+const (
+	SubstateRecordRLP      byte = 1 // RLP in the current (Cancun) layout
+	SubstateRecordProtobuf byte = 2 // protobuf
+)
+
+// substateRecordDecoders decode the payload of a tagged record by its schema version.
+var substateRecordDecoders = map[byte]func([]byte, codeLookupFunc, uint64, int) (*substate.Substate, error){
+	SubstateRecordRLP:      decodeRlpRecord,
+	SubstateRecordProtobuf: decodeProtobuf,
 }
 
 // decodeFunc aliases the common function used to decode substate
@@ -56,20 +195,30 @@ func newSubstateEncoding(encoding string, lookup codeLookupFunc) (*substateEncod
 
 	case "", "default", "rlp":
 		return &substateEncoding{
-			schema: "rlp",
+			schema:  "rlp",
+			version: SubstateRecordRLP,
+			payload: encodeRlp,
 			decode: func(bytes []byte, block uint64, tx int) (*substate.Substate, error) {
+				if ss, tagged, err := decodeSubstateRecord(bytes, lookup, block, tx); tagged {
+					return ss, err
+				}
 				return decodeRlp(bytes, lookup, block, tx)
 			},
-			encode: encodeRlp,
+			encode: withRecordHeader(SubstateRecordRLP, encodeRlp, nil),
 		}, nil
 
 	case "protobuf", "pb":
 		return &substateEncoding{
-			schema: "protobuf",
+			schema:  "protobuf",
+			version: SubstateRecordProtobuf,
+			payload: pb.Encode,
 			decode: func(bytes []byte, block uint64, tx int) (*substate.Substate, error) {
+				if ss, tagged, err := decodeSubstateRecord(bytes, lookup, block, tx); tagged {
+					return ss, err
+				}
 				return decodeProtobuf(bytes, lookup, block, tx)
 			},
-			encode: pb.Encode,
+			encode: withRecordHeader(SubstateRecordProtobuf, pb.Encode, nil),
 		}, nil
 
 	default:
@@ -78,6 +227,70 @@ func newSubstateEncoding(encoding string, lookup codeLookupFunc) (*substateEncod
 	}
 }
 
+// withRecordHeader prefixes records produced by encode with a header of given schema version.
+// If codec is not nil, the records are compressed and their header names the codec.
+func withRecordHeader(version byte, encode encodeFunc, codec SubstateCodec) encodeFunc {
+	return func(ss *substate.Substate, block uint64, tx int) ([]byte, error) {
+		payload, err := encode(ss, block, tx)
+		if err != nil {
+			return nil, err
+		}
+		if codec == nil {
+			record := make([]byte, 0, SubstateRecordHeaderSize+len(payload))
+			record = append(record, SubstateRecordMagic, version)
+			return append(record, payload...), nil
+		}
+
+		compressed, err := codec.Compress(payload)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compress substate block: %v, tx %v; %w", block, tx, err)
+		}
+		record := make([]byte, 0, SubstateRecordHeaderSize+1+len(compressed))
+		record = append(record, SubstateRecordMagic, version|SubstateRecordCompressed, codec.ID())
+		return append(record, compressed...), nil
+	}
+}
+
+// decodeSubstateRecord decodes a record written with a header using the decoder of its
+// schema version. It returns tagged=false if the record has no header, i.e. it was written
+// before headers were introduced and must be decoded by the configured encoding.
+func decodeSubstateRecord(bytes []byte, lookup codeLookupFunc, block uint64, tx int) (ss *substate.Substate, tagged bool, err error) {
+	if len(bytes) < SubstateRecordHeaderSize || bytes[0] != SubstateRecordMagic {
+		return nil, false, nil
+	}
+
+	version, payload := bytes[1], bytes[SubstateRecordHeaderSize:]
+	if version&SubstateRecordCompressed != 0 {
+		version &^= SubstateRecordCompressed
+		if payload, err = decompressSubstateRecord(payload); err != nil {
+			return nil, true, fmt.Errorf("cannot decode substate block: %v, tx %v; %w", block, tx, err)
+		}
+	}
+
+	decode, ok := substateRecordDecoders[version]
+	if !ok {
+		return nil, true, fmt.Errorf("cannot decode substate block: %v, tx %v; unknown record schema version %v", block, tx, version)
+	}
+	ss, err = decode(payload, lookup, block, tx)
+	return ss, true, err
+}
+
+// decompressSubstateRecord decompresses a payload prefixed by the ID of its codec.
+func decompressSubstateRecord(payload []byte) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("missing codec of compressed record")
+	}
+	codec, ok := substateCodecByID(payload[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown record codec %v", payload[0])
+	}
+	decompressed, err := codec.Decompress(payload[1:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress record with %v; %w", codec.Name(), err)
+	}
+	return decompressed, nil
+}
+
 // decodeSubstate defensively defaults to "default" if nil
 func (db *substateDB) decodeToSubstate(bytes []byte, block uint64, tx int) (*substate.Substate, error) {
 	return db.encoding.decode(bytes, block, tx)
@@ -98,6 +311,16 @@ func decodeRlp(bytes []byte, lookup codeLookupFunc, block uint64, tx int) (*subs
 	return rlpSubstate.ToSubstate(lookup, block, tx)
 }
 
+// decodeRlpRecord decodes into substate the provided rlp-encoded bytecode in the current layout
+func decodeRlpRecord(bytes []byte, lookup codeLookupFunc, block uint64, tx int) (*substate.Substate, error) {
+	var rlpSubstate rlp.RLP
+	if err := trlp.DecodeBytes(bytes, &rlpSubstate); err != nil {
+		return nil, fmt.Errorf("cannot decode substate data from rlp block: %v, tx %v; %w", block, tx, err)
+	}
+
+	return rlpSubstate.ToSubstate(lookup, block, tx)
+}
+
 // encodeRlp encodes substate into rlp-encoded bytes
 func encodeRlp(ss *substate.Substate, block uint64, tx int) ([]byte, error) {
 	bytes, err := trlp.EncodeToBytes(rlp.NewRLP(ss))
@@ -1,11 +1,13 @@
 package db
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
 	pb "github.com/0xsoniclabs/substate/protobuf"
 	"github.com/0xsoniclabs/substate/rlp"
+	"github.com/0xsoniclabs/substate/substate"
 	trlp "github.com/0xsoniclabs/substate/types/rlp"
 )
 
@@ -142,3 +144,206 @@ func TestSubstateEncoding_TestIterator(t *testing.T) {
 		testSubstatorIterator_Value(db, t)
 	}
 }
+
+// newEncodingTestSubstate returns a copy of testSubstate with empty world states,
+// such that decoding does not depend on code stored in the db.
+func newEncodingTestSubstate() *substate.Substate {
+	ss := *testSubstate
+	ss.InputSubstate = substate.NewWorldState()
+	ss.OutputSubstate = substate.NewWorldState()
+	return &ss
+}
+
+func TestSubstateEncoding_RecordHeader(t *testing.T) {
+	versions := map[string]byte{
+		"rlp":      SubstateRecordRLP,
+		"protobuf": SubstateRecordProtobuf,
+	}
+	for encoding, version := range versions {
+		path := t.TempDir() + "test-db-" + encoding
+		db, err := newSubstateDB(path, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("cannot open db; %v", err)
+		}
+		if _, err = db.SetSubstateEncoding(encoding); err != nil {
+			t.Fatal(err)
+		}
+
+		want := newEncodingTestSubstate()
+		record, err := db.encodeSubstate(want, blk, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record[0] != SubstateRecordMagic || record[1] != version {
+			t.Fatalf("unexpected header of %v record; got %x", encoding, record[:SubstateRecordHeaderSize])
+		}
+
+		ss, err := db.decodeToSubstate(record, blk, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = want.Equal(ss); err != nil {
+			t.Fatalf("%v record does not round trip; %v", encoding, err)
+		}
+	}
+}
+
+func TestSubstateEncoding_TaggedRecordsDecodeRegardlessOfEncoding(t *testing.T) {
+	path := t.TempDir() + "test-db"
+	db, err := newSubstateDB(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open db; %v", err)
+	}
+
+	want := newEncodingTestSubstate()
+	var records [][]byte
+	for encoding := range supportedEncoding {
+		if _, err = db.SetSubstateEncoding(encoding); err != nil {
+			t.Fatal(err)
+		}
+		record, err := db.encodeSubstate(want, blk, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	for encoding := range supportedEncoding {
+		if _, err = db.SetSubstateEncoding(encoding); err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range records {
+			ss, err := db.decodeToSubstate(record, blk, tx)
+			if err != nil {
+				t.Fatalf("%v db cannot decode record with schema %v; %v", encoding, record[1], err)
+			}
+			if err = want.Equal(ss); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestSubstateEncoding_UntaggedRecordsCannotBeMistakenForTagged(t *testing.T) {
+	for encoding, et := range supportedEncoding {
+		if et.bytes[0] == SubstateRecordMagic {
+			t.Fatalf("untagged %v record starts with the magic byte", encoding)
+		}
+	}
+}
+
+func TestSubstateEncoding_UnknownRecordVersion(t *testing.T) {
+	path := t.TempDir() + "test-db"
+	db, err := newSubstateDB(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open db; %v", err)
+	}
+
+	record := append([]byte{SubstateRecordMagic, 0x7f}, testRlp.bytes...)
+	_, err = db.decodeToSubstate(record, blk, tx)
+	if err == nil || !strings.Contains(err.Error(), "unknown record schema version") {
+		t.Fatalf("unexpected error; %v", err)
+	}
+}
+
+func TestSubstateEncoding_DetectsEncodingFromMetadata(t *testing.T) {
+	path := t.TempDir() + "test-db"
+	db, err := newSubstateDB(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open db; %v", err)
+	}
+	if _, err = db.SetSubstateEncoding("protobuf"); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.PutSubstate(newEncodingTestSubstate()); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get([]byte(SubstateEncodingKey)); err != nil || string(got) != "protobuf" {
+		t.Fatalf("unexpected stored encoding; got %q, err %v", got, err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = newSubstateDB(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot reopen db; %v", err)
+	}
+	defer db.Close()
+
+	if got := db.GetSubstateEncoding(); got != "protobuf" {
+		t.Fatalf("unexpected encoding; got %v, want protobuf", got)
+	}
+	if _, err = db.GetSubstate(blk, tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubstateEncoding_DetectsEncodingFromFirstRecord(t *testing.T) {
+	for encoding, et := range supportedEncoding {
+		path := t.TempDir() + "test-db-" + encoding
+		db, err := newSubstateDB(path, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("cannot open db; %v", err)
+		}
+		// untagged record written without encoding metadata
+		if err = db.Put(SubstateDBKey(et.blk, et.tx), et.bytes); err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = newSubstateDB(path, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("cannot reopen db; %v", err)
+		}
+		if got := db.GetSubstateEncoding(); got != encoding {
+			t.Fatalf("unexpected encoding; got %v, want %v", got, encoding)
+		}
+		if _, err = db.GetSubstate(et.blk, et.tx); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+	}
+}
+
+func TestSubstateEncoding_MismatchingEncodingThrowsError(t *testing.T) {
+	path := t.TempDir() + "test-db"
+	db, err := newSubstateDB(path, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("cannot open db; %v", err)
+	}
+	if err = db.PutSubstate(newEncodingTestSubstate()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.SetSubstateEncoding("protobuf")
+	if !errors.Is(err, ErrSubstateEncodingMismatch) {
+		t.Fatalf("unexpected error; %v", err)
+	}
+	if got := db.GetSubstateEncoding(); got != "rlp" {
+		t.Fatalf("encoding must not change; got %v", got)
+	}
+
+	if _, err = db.SetSubstateEncoding("rlp"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubstateEncoding_FingerprintIsIndependentOfEncoding(t *testing.T) {
+	want := newTestSubstate(1, 1)
+	for encoding := range supportedEncoding {
+		db := createTestSubstateDB(t, encoding, 1, 0, 0)
+		if err := db.PutSubstate(want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.GetSubstate(1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Fingerprint() != want.Fingerprint() {
+			t.Fatalf("fingerprint of %v substate differs\ngot: %v\nwant: %v", encoding, got.Fingerprint(), want.Fingerprint())
+		}
+	}
+}
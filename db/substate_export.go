@@ -0,0 +1,211 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/0xsoniclabs/substate/types"
+	trlp "github.com/0xsoniclabs/substate/types/rlp"
+	"github.com/0xsoniclabs/substate/updateset"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const defaultExportBatchSize = 64 * 1024 * 1024
+
+// ExportConfig contains options of ExportSubstates.
+type ExportConfig struct {
+	First uint64 // first exported block
+	Last  uint64 // last exported block
+
+	UpdateDB           UpdateDB            // optional; its update sets within the range are exported with their codes
+	DestroyedAccountDB *DestroyedAccountDB // optional; its destroyed accounts within the range are exported
+
+	BatchSize int // number of bytes buffered before they are written into the target; 64 MiB if not positive
+}
+
+// ExportStats counts the records copied by ExportSubstates.
+type ExportStats struct {
+	Substates         int64
+	Codes             int64
+	UpdateSets        int64
+	DestroyedAccounts int64
+}
+
+// ExportSubstates copies the substates of blocks cfg.First to cfg.Last from src into dst
+// together with exactly the codes they reference. If given, the update sets and destroyed
+// accounts of the range are copied from cfg.UpdateDB and cfg.DestroyedAccountDB into dst
+// as well, so dst is a standalone db of the range.
+//
+// Records are copied as stored without being re-encoded, hence dst is set to the encoding
+// of src and must not contain substates of another encoding. Records are streamed from the
+// sources and written in batches of cfg.BatchSize bytes.
+func ExportSubstates(src, dst SubstateDB, cfg ExportConfig) (ExportStats, error) {
+	var stats ExportStats
+	if cfg.First > cfg.Last {
+		return stats, fmt.Errorf("cannot export substates; first block %v is after last block %v", cfg.First, cfg.Last)
+	}
+
+	// decoding looks up every referenced code hash
+	var references []types.Hash
+	encoding, err := newSubstateEncoding(src.GetSubstateEncoding(), func(codeHash types.Hash) ([]byte, error) {
+		references = append(references, codeHash)
+		return nil, nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("cannot export substates; %w", err)
+	}
+	if _, err = dst.SetSubstateEncoding(encoding.schema); err != nil {
+		return stats, fmt.Errorf("cannot export substates; %w", err)
+	}
+
+	e := &exporter{
+		batch:     dst.NewBatch(),
+		batchSize: cfg.BatchSize,
+		exported:  make(map[types.Hash]struct{}),
+		stats:     &stats,
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = defaultExportBatchSize
+	}
+	if err = e.batch.Put([]byte(SubstateEncodingKey), []byte(encoding.schema)); err != nil {
+		return stats, err
+	}
+
+	// export substates with their codes
+	err = exportRange(src, SubstateDBPrefix, cfg.Last, BlockToBytes(cfg.First), func(key, value []byte) (uint64, error) {
+		block, tx, err := DecodeSubstateDBKey(key)
+		if err != nil || block > cfg.Last {
+			return block, err
+		}
+		references = references[:0]
+		if _, err = encoding.decode(value, block, tx); err != nil {
+			return block, err
+		}
+		for _, codeHash := range references {
+			if err = e.putCode(src, codeHash); err != nil {
+				return block, fmt.Errorf("cannot export code of substate block: %v, tx: %v; %w", block, tx, err)
+			}
+		}
+		stats.Substates++
+		return block, e.put(key, value)
+	})
+	if err != nil {
+		return stats, fmt.Errorf("cannot export substates; %w", err)
+	}
+
+	// export update sets with their codes
+	if cfg.UpdateDB != nil {
+		err = exportRange(cfg.UpdateDB, UpdateDBPrefix, cfg.Last, BlockToBytes(cfg.First), func(key, value []byte) (uint64, error) {
+			block, err := DecodeUpdateSetKey(key)
+			if err != nil || block > cfg.Last {
+				return block, err
+			}
+			var updateSet updateset.UpdateSetRLP
+			if err = trlp.DecodeBytes(value, &updateSet); err != nil {
+				return block, fmt.Errorf("cannot decode update-set rlp block: %v; %w", block, err)
+			}
+			for _, acc := range updateSet.WorldState.Accounts {
+				if err = e.putCode(cfg.UpdateDB, acc.CodeHash); err != nil {
+					return block, fmt.Errorf("cannot export code of update-set block: %v; %w", block, err)
+				}
+			}
+			stats.UpdateSets++
+			return block, e.put(key, value)
+		})
+		if err != nil {
+			return stats, fmt.Errorf("cannot export update sets; %w", err)
+		}
+		for _, key := range []string{UpdatesetIntervalKey, UpdatesetSizeKey} {
+			if err = e.copy(cfg.UpdateDB, []byte(key)); err != nil {
+				return stats, fmt.Errorf("cannot export update-set metadata; %w", err)
+			}
+		}
+	}
+
+	// export destroyed accounts
+	if cfg.DestroyedAccountDB != nil {
+		err = exportRange(cfg.DestroyedAccountDB.backend, DestroyedAccountPrefix, cfg.Last, BlockToBytes(cfg.First), func(key, value []byte) (uint64, error) {
+			block, _, err := DecodeDestroyedAccountKey(key)
+			if err != nil || block > cfg.Last {
+				return block, err
+			}
+			stats.DestroyedAccounts++
+			return block, e.put(key, value)
+		})
+		if err != nil {
+			return stats, fmt.Errorf("cannot export destroyed accounts; %w", err)
+		}
+	}
+
+	return stats, e.flush()
+}
+
+// exportRange calls export for every record of prefix from start until export returns a
+// block after last.
+func exportRange(db BaseDB, prefix string, last uint64, start []byte, export func(key, value []byte) (uint64, error)) error {
+	iter := db.NewIterator([]byte(prefix), start)
+	defer iter.Release()
+	for iter.Next() {
+		block, err := export(iter.Key(), iter.Value())
+		if err != nil {
+			return fmt.Errorf("key %v; %w", iter.Key(), err)
+		}
+		if block > last {
+			return nil
+		}
+	}
+	return iter.Error()
+}
+
+// exporter buffers exported records in a batch.
+type exporter struct {
+	batch     Batch
+	batchSize int
+	exported  map[types.Hash]struct{} // codes already put into the batch
+	stats     *ExportStats
+}
+
+// put puts the record into the batch and writes the batch once it exceeds the batch size.
+func (e *exporter) put(key, value []byte) error {
+	if err := e.batch.Put(key, value); err != nil {
+		return err
+	}
+	if e.batch.ValueSize() < e.batchSize {
+		return nil
+	}
+	return e.flush()
+}
+
+// putCode puts the code of given hash read from db unless it was exported already.
+func (e *exporter) putCode(db CodeDB, codeHash types.Hash) error {
+	if _, ok := e.exported[codeHash]; ok {
+		return nil
+	}
+	code, err := db.GetCode(codeHash)
+	if err != nil {
+		return err
+	}
+	e.exported[codeHash] = struct{}{}
+	e.stats.Codes++
+	return e.put(CodeDBKey(codeHash), code)
+}
+
+// copy puts the record of given key read from db if it exists.
+func (e *exporter) copy(db BaseDB, key []byte) error {
+	value, err := db.Get(key)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return e.put(key, value)
+}
+
+func (e *exporter) flush() error {
+	if err := e.batch.Write(); err != nil {
+		return fmt.Errorf("cannot write batch; %w", err)
+	}
+	e.batch.Reset()
+	return nil
+}
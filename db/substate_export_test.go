@@ -0,0 +1,82 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/0xsoniclabs/substate/types/hash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportSubstates_CopiesBlockRangeWithReferencedCodes(t *testing.T) {
+	for _, encoding := range []string{"rlp", "protobuf"} {
+		t.Run(encoding, func(t *testing.T) {
+			src := createVerifyTestDB(t, encoding)
+			dst := createTestSubstateDB(t, "", 1, 0, 0)
+
+			stats, err := ExportSubstates(src, dst, ExportConfig{
+				First:              2,
+				Last:               2,
+				UpdateDB:           MakeDefaultUpdateDBFromBaseDB(src),
+				DestroyedAccountDB: MakeDefaultDestroyedAccountDBFromBaseDB(src),
+				BatchSize:          1,
+			})
+			require.NoError(t, err)
+			require.Equal(t, int64(2), stats.Substates)
+			require.Equal(t, int64(1), stats.UpdateSets)
+			require.Equal(t, int64(1), stats.DestroyedAccounts)
+			require.Equal(t, encoding, dst.GetSubstateEncoding())
+
+			// only substates of the range are exported
+			for block := uint64(1); block <= 3; block++ {
+				for tx := 0; tx < 2; tx++ {
+					has, err := dst.HasSubstate(block, tx)
+					require.NoError(t, err)
+					require.Equal(t, block == 2, has, "substate %v_%v", block, tx)
+				}
+			}
+			requireSameSubstates(t, src, dst, 2, 2, 2)
+
+			updateSet, err := MakeDefaultUpdateDBFromBaseDB(dst).GetUpdateSet(2)
+			require.NoError(t, err)
+			require.Len(t, updateSet.WorldState, 1)
+			interval, size, err := MakeDefaultUpdateDBFromBaseDB(dst).(*updateDB).GetMetadata()
+			require.NoError(t, err)
+			require.Equal(t, []uint64{1000, 10}, []uint64{interval, size})
+
+			destroyed, _, err := MakeDefaultDestroyedAccountDBFromBaseDB(dst).GetDestroyedAccounts(2, 1)
+			require.NoError(t, err)
+			require.Equal(t, []types.Address{{4}}, destroyed)
+
+			// exactly the referenced codes are exported
+			report, err := VerifySubstateDB(dst, VerifyConfig{})
+			require.NoError(t, err)
+			require.True(t, report.OK(), "unexpected issues: %v", report.Issues)
+			require.Equal(t, stats.Codes, report.Records[CodeDBPrefix])
+			gc, err := CollectCodeGarbage(dst, CodeGCConfig{})
+			require.NoError(t, err)
+			require.Empty(t, gc.Orphaned)
+
+			has, err := dst.HasCode(hash.Keccak256Hash([]byte{1, 0}))
+			require.NoError(t, err)
+			require.False(t, has, "code of block 1 must not be exported")
+		})
+	}
+}
+
+func TestExportSubstates_FailsOnMissingCode(t *testing.T) {
+	src := createVerifyTestDB(t, "rlp")
+	require.NoError(t, src.DeleteCode(hash.Keccak256Hash([]byte{2, 0})))
+	dst := createTestSubstateDB(t, "", 1, 0, 0)
+
+	_, err := ExportSubstates(src, dst, ExportConfig{First: 1, Last: 3})
+	require.ErrorContains(t, err, "cannot export code of substate block: 2, tx: 0")
+}
+
+func TestExportSubstates_RejectsInvalidRange(t *testing.T) {
+	src := createVerifyTestDB(t, "rlp")
+	dst := createTestSubstateDB(t, "", 1, 0, 0)
+
+	_, err := ExportSubstates(src, dst, ExportConfig{First: 3, Last: 2})
+	require.ErrorContains(t, err, "first block 3 is after last block 2")
+}
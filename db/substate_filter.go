@@ -0,0 +1,295 @@
+package db
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types"
+)
+
+// SubstateFilter is a predicate which reports whether a substate is selected.
+// Filters compose with And, Or, Not, AllOf and AnyOf. A nil filter selects every
+// substate, also when composed.
+type SubstateFilter func(ss *substate.Substate) bool
+
+// selects reports whether f selects ss; a nil filter selects every substate.
+func (f SubstateFilter) selects(ss *substate.Substate) bool {
+	return f == nil || f(ss)
+}
+
+// And returns a filter selecting substates selected by both f and g.
+func (f SubstateFilter) And(g SubstateFilter) SubstateFilter {
+	return AllOf(f, g)
+}
+
+// Or returns a filter selecting substates selected by f or g.
+func (f SubstateFilter) Or(g SubstateFilter) SubstateFilter {
+	return AnyOf(f, g)
+}
+
+// Not returns a filter selecting substates which are not selected by f. The negation of a
+// nil filter selects no substate.
+func (f SubstateFilter) Not() SubstateFilter {
+	return func(ss *substate.Substate) bool {
+		return !f.selects(ss)
+	}
+}
+
+// AllOf returns a filter selecting substates selected by every filter. It selects every
+// substate if no filters are given.
+func AllOf(filters ...SubstateFilter) SubstateFilter {
+	return func(ss *substate.Substate) bool {
+		for _, f := range filters {
+			if !f.selects(ss) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyOf returns a filter selecting substates selected by at least one filter, hence a nil
+// filter makes it select every substate. It selects no substate if no filters are given.
+func AnyOf(filters ...SubstateFilter) SubstateFilter {
+	return func(ss *substate.Substate) bool {
+		for _, f := range filters {
+			if f.selects(ss) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var (
+	// IsTransferTx selects transactions that only transfer ETH, i.e. calls of accounts without bytecode.
+	IsTransferTx SubstateFilter = func(ss *substate.Substate) bool {
+		to := ss.Message.To
+		if to == nil {
+			return false
+		}
+		account, exist := ss.InputSubstate[*to]
+		return !exist || len(account.Code) == 0
+	}
+
+	// IsCallTx selects CALL transactions to accounts with contract bytecode.
+	IsCallTx SubstateFilter = func(ss *substate.Substate) bool {
+		to := ss.Message.To
+		if to == nil {
+			return false
+		}
+		account, exist := ss.InputSubstate[*to]
+		return exist && len(account.Code) > 0
+	}
+
+	// IsCreateTx selects CREATE transactions.
+	IsCreateTx SubstateFilter = func(ss *substate.Substate) bool {
+		return ss.Message.To == nil
+	}
+
+	// IsFailedTx selects transactions with failed receipt status.
+	IsFailedTx SubstateFilter = func(ss *substate.Substate) bool {
+		return ss.Result.Status == 0
+	}
+
+	// IsBlobTx selects transactions carrying blob hashes (EIP-4844).
+	IsBlobTx SubstateFilter = func(ss *substate.Substate) bool {
+		return len(ss.Message.BlobHashes) > 0
+	}
+
+	// HasAccessList selects transactions with a non-empty access list (EIP-2930).
+	HasAccessList SubstateFilter = func(ss *substate.Substate) bool {
+		return len(ss.Message.AccessList) > 0
+	}
+)
+
+// TouchesAddress returns a filter selecting transactions sent from or to addr
+// or having addr in their input or output substate.
+func TouchesAddress(addr types.Address) SubstateFilter {
+	return func(ss *substate.Substate) bool {
+		if ss.Message.From == addr || (ss.Message.To != nil && *ss.Message.To == addr) {
+			return true
+		}
+		_, in := ss.InputSubstate[addr]
+		_, out := ss.OutputSubstate[addr]
+		return in || out
+	}
+}
+
+// GasUsedAbove returns a filter selecting transactions which used more than gas.
+func GasUsedAbove(gas uint64) SubstateFilter {
+	return func(ss *substate.Substate) bool {
+		return ss.Result.GasUsed > gas
+	}
+}
+
+// substateFilterAtoms are predicates without argument usable in filter expressions.
+var substateFilterAtoms = map[string]SubstateFilter{
+	"transfer":   IsTransferTx,
+	"call":       IsCallTx,
+	"create":     IsCreateTx,
+	"failed":     IsFailedTx,
+	"blob":       IsBlobTx,
+	"accesslist": HasAccessList,
+}
+
+// ParseSubstateFilter parses a filter expression such as
+//
+//	!transfer && (failed || gas > 100000) && touches(0x00000000219ab540356cBB839Cbe05303d7705Fa)
+//
+// Predicates are transfer, call, create, failed, blob, accesslist, touches(<address>)
+// and gas > <number>. They combine with !, &&, || and parentheses; && binds tighter than ||.
+func ParseSubstateFilter(expr string) (SubstateFilter, error) {
+	p := &filterParser{tokens: tokenizeFilter(expr)}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q; %w", expr, err)
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("invalid filter %q; unexpected %q", expr, tok)
+	}
+	return f, nil
+}
+
+// tokenizeFilter splits expr into identifiers, literals and operators.
+func tokenizeFilter(expr string) []string {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case strings.ContainsRune("!()>", c):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) || expr[j] == '_') {
+				j++
+			}
+			if j == i {
+				// unknown character, let the parser report it
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) expect(want string) error {
+	if got := p.next(); got != want {
+		return fmt.Errorf("expected %q, got %q", want, got)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (SubstateFilter, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		g, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		f = f.Or(g)
+	}
+	return f, nil
+}
+
+func (p *filterParser) parseAnd() (SubstateFilter, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		g, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		f = f.And(g)
+	}
+	return f, nil
+}
+
+func (p *filterParser) parseUnary() (SubstateFilter, error) {
+	switch tok := p.next(); tok {
+	case "!":
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return f.Not(), nil
+
+	case "(":
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+
+	case "touches":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		arg := p.next()
+		addr, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(arg, "0x"), "0X"))
+		if err != nil || len(addr) != types.AddressLength {
+			return nil, fmt.Errorf("invalid address %q", arg)
+		}
+		return TouchesAddress(types.BytesToAddress(addr)), p.expect(")")
+
+	case "gas":
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+		arg := p.next()
+		gas, err := strconv.ParseUint(arg, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gas %q", arg)
+		}
+		return GasUsedAbove(gas), nil
+
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+
+	default:
+		f, ok := substateFilterAtoms[tok]
+		if !ok {
+			return nil, fmt.Errorf("unknown predicate %q", tok)
+		}
+		return f, nil
+	}
+}
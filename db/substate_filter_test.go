@@ -0,0 +1,174 @@
+package db
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/stretchr/testify/require"
+)
+
+// newFilterTestSubstate returns a successful transaction from address 1 to
+// address 2 using given gas; address 2 has code if withCode is set.
+func newFilterTestSubstate(to *types.Address, withCode bool, gas uint64) *substate.Substate {
+	ss := &substate.Substate{
+		InputSubstate:  substate.NewWorldState(),
+		OutputSubstate: substate.NewWorldState(),
+		Message:        substate.NewMessage(1, true, new(big.Int).SetUint64(1), 1, types.Address{1}, to, new(big.Int).SetUint64(1), []byte{1}, nil, types.AccessList{}, new(big.Int).SetUint64(1), new(big.Int).SetUint64(1), new(big.Int).SetUint64(1), nil),
+		Result:         substate.NewResult(1, types.Bloom{}, []*types.Log{}, types.Address{}, gas),
+	}
+	if to != nil && withCode {
+		ss.InputSubstate[*to] = substate.NewAccount(1, new(big.Int).SetUint64(1), []byte{1})
+	}
+	return ss
+}
+
+func TestSubstateFilter_Predicates(t *testing.T) {
+	to := types.Address{2}
+	transfer := newFilterTestSubstate(&to, false, 21_000)
+	call := newFilterTestSubstate(&to, true, 50_000)
+	create := newFilterTestSubstate(nil, false, 100_000)
+
+	require.True(t, IsTransferTx(transfer))
+	require.False(t, IsTransferTx(call))
+	require.False(t, IsTransferTx(create))
+
+	require.False(t, IsCallTx(transfer))
+	require.True(t, IsCallTx(call))
+	require.False(t, IsCallTx(create))
+
+	require.False(t, IsCreateTx(transfer))
+	require.False(t, IsCreateTx(call))
+	require.True(t, IsCreateTx(create))
+
+	require.False(t, IsFailedTx(call))
+	call.Result.Status = 0
+	require.True(t, IsFailedTx(call))
+
+	require.False(t, IsBlobTx(call))
+	call.Message.BlobHashes = []types.Hash{{1}}
+	require.True(t, IsBlobTx(call))
+
+	require.False(t, HasAccessList(call))
+	call.Message.AccessList = types.AccessList{{Address: types.Address{3}}}
+	require.True(t, HasAccessList(call))
+
+	require.True(t, TouchesAddress(types.Address{1})(create))
+	require.True(t, TouchesAddress(to)(transfer))
+	require.False(t, TouchesAddress(types.Address{4})(call))
+	call.OutputSubstate[types.Address{4}] = substate.NewAccount(1, new(big.Int), nil)
+	require.True(t, TouchesAddress(types.Address{4})(call))
+
+	require.False(t, GasUsedAbove(21_000)(transfer))
+	require.True(t, GasUsedAbove(20_999)(transfer))
+}
+
+func TestSubstateFilter_Composition(t *testing.T) {
+	to := types.Address{2}
+	call := newFilterTestSubstate(&to, true, 50_000)
+
+	require.True(t, IsCallTx.And(GasUsedAbove(1))(call))
+	require.False(t, IsCallTx.And(IsCreateTx)(call))
+	require.True(t, IsCreateTx.Or(IsCallTx)(call))
+	require.False(t, IsCreateTx.Or(IsTransferTx)(call))
+	require.True(t, IsCreateTx.Not()(call))
+
+	require.True(t, AllOf()(call))
+	require.True(t, AllOf(nil, IsCallTx)(call))
+	require.False(t, AnyOf()(call))
+	require.True(t, AnyOf(nil, IsCreateTx, IsCallTx)(call))
+}
+
+func TestSubstateFilter_NilSelectsEverySubstate(t *testing.T) {
+	to := types.Address{2}
+	call := newFilterTestSubstate(&to, true, 50_000)
+	var none SubstateFilter
+
+	require.True(t, AllOf(none, IsCallTx)(call))
+	require.False(t, AllOf(none, IsCreateTx)(call))
+	require.True(t, AnyOf(none, IsCreateTx)(call))
+	require.True(t, none.And(IsCallTx)(call))
+	require.True(t, none.Or(IsCreateTx)(call))
+	require.False(t, none.Not()(call))
+	require.True(t, none.Not().Not()(call))
+}
+
+func TestSubstateFilter_ParseSubstateFilter(t *testing.T) {
+	to := types.Address{2}
+	transfer := newFilterTestSubstate(&to, false, 21_000)
+	call := newFilterTestSubstate(&to, true, 50_000)
+	create := newFilterTestSubstate(nil, false, 100_000)
+	create.Result.Status = 0
+
+	tests := []struct {
+		expr                   string
+		transfer, call, create bool
+	}{
+		{"transfer", true, false, false},
+		{"!transfer", false, true, true},
+		{"call || create", false, true, true},
+		{"!transfer && !failed", false, true, false},
+		{"failed || gas > 30000 && call", false, true, true},
+		{"(failed || gas > 30000) && call", false, true, false},
+		{"!!create", false, false, true},
+		{"gas > 0x5208", false, true, true},
+		{"touches(0x0200000000000000000000000000000000000000)", true, true, false},
+		{"blob || accesslist", false, false, false},
+	}
+	for _, test := range tests {
+		f, err := ParseSubstateFilter(test.expr)
+		require.NoError(t, err, test.expr)
+		require.Equal(t, test.transfer, f(transfer), test.expr)
+		require.Equal(t, test.call, f(call), test.expr)
+		require.Equal(t, test.create, f(create), test.expr)
+	}
+}
+
+func TestSubstateFilter_ParseSubstateFilterInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"unknown",
+		"transfer &&",
+		"transfer create",
+		"(transfer",
+		"transfer)",
+		"gas 10",
+		"gas > abc",
+		"touches(0x12)",
+		"touches(0x0200000000000000000000000000000000000000",
+		"transfer & call",
+	} {
+		_, err := ParseSubstateFilter(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestSubstateTaskPool_ExecuteBlockFilter(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	require.NoError(t, err)
+
+	var executed int
+	stPool := SubstateTaskPool{
+		Name: "test",
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			executed++
+			return nil
+		},
+		Filter: IsCallTx,
+		DB:     db,
+	}
+
+	numTx, _, err := stPool.ExecuteBlock(testSubstate.Block)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), numTx)
+	require.Equal(t, 0, executed)
+
+	stPool.Filter = IsTransferTx.And(GasUsedAbove(0))
+	numTx, gas, err := stPool.ExecuteBlock(testSubstate.Block)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), numTx)
+	require.Equal(t, int64(1), gas)
+	require.Equal(t, 1, executed)
+}
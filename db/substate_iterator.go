@@ -1,25 +1,88 @@
 package db
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 
 	"github.com/0xsoniclabs/substate/substate"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// SubstateRange describes a bounded range of substates.
+type SubstateRange struct {
+	// FirstBlock is the first block of the range.
+	FirstBlock uint64
+
+	// FirstTx is the first transaction of FirstBlock; earlier transactions of FirstBlock are skipped.
+	FirstTx int
+
+	// LastBlock is the last block of the range.
+	LastBlock uint64
+
+	// ExclusiveEnd excludes LastBlock from the range.
+	ExclusiveEnd bool
+
+	// Sampler optionally restricts the range to blocks selected by the sampler.
+	Sampler BlockSampler
+}
+
+// keyRange returns the substate key range covered by r.
+func (r SubstateRange) keyRange() *util.Range {
+	kr := &util.Range{Start: SubstateDBKey(r.FirstBlock, r.FirstTx)}
+	switch {
+	case r.ExclusiveEnd:
+		kr.Limit = SubstateDBBlockPrefix(r.LastBlock)
+	case r.LastBlock == math.MaxUint64:
+		kr.Limit = util.BytesPrefix([]byte(SubstateDBPrefix)).Limit
+	default:
+		kr.Limit = SubstateDBBlockPrefix(r.LastBlock + 1)
+	}
+
+	// empty range
+	if bytes.Compare(kr.Start, kr.Limit) > 0 {
+		kr.Limit = kr.Start
+	}
+	return kr
+}
+
 func newSubstateIterator(db *substateDB, start []byte) *substateIterator {
 	r := util.BytesPrefix([]byte(SubstateDBPrefix))
 	r.Start = append(r.Start, start...)
 
+	return newSubstateRangeIterator(db, r, nil)
+}
+
+func newSubstateRangeIterator(db *substateDB, r *util.Range, sampler BlockSampler) *substateIterator {
 	return &substateIterator{
-		iterator: newIterator[*substate.Substate](db.backend.NewIterator(r, db.ro)),
+		iterator: newIterator[*substate.Substate](db.backend.NewIterator(r)),
 		db:       db,
+		sampler:  sampler,
 	}
 }
 
 type substateIterator struct {
 	iterator[*substate.Substate]
-	db *substateDB
+	db      *substateDB
+	sampler BlockSampler // optional; substates of blocks not selected are skipped
+}
+
+// nextSampled moves the iterator to the next substate of a sampled block.
+func (i *substateIterator) nextSampled() bool {
+	ok := i.iter.Next()
+	for ok && i.sampler != nil {
+		block, _, err := DecodeSubstateDBKey(i.iter.Key())
+		if err != nil || i.sampler(block) {
+			// invalid keys are reported by decode
+			return true
+		}
+		if block == math.MaxUint64 {
+			return false
+		}
+		// skip all substates of the block
+		ok = i.iter.Seek(SubstateDBBlockPrefix(block + 1))
+	}
+	return ok
 }
 
 func (i *substateIterator) decode(data rawEntry) (*substate.Substate, error) {
@@ -55,7 +118,7 @@ func (i *substateIterator) start(numWorkers int) {
 			i.wg.Done()
 		}()
 		step := 0
-		for i.iter.Next() {
+		for i.nextSampled() {
 			key := make([]byte, len(i.iter.Key()))
 			copy(key, i.iter.Key())
 			value := make([]byte, len(i.iter.Value()))
@@ -1,35 +1,41 @@
 package db
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 )
 
 func TestSubstateIterator_Next(t *testing.T) {
-	path := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(path)
-	if err != nil {
-		return
-	}
-
-	iter := db.NewSubstateIterator(0, 10)
-	if !iter.Next() {
-		t.Fatal("next must return true")
-	}
-
-	if iter.Next() {
-		t.Fatal("next must return false, all substates were extracted")
-	}
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		path := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(path, engine)
+		if err != nil {
+			return
+		}
+
+		iter := db.NewSubstateIterator(0, 10)
+		if !iter.Next() {
+			t.Fatal("next must return true")
+		}
+
+		if iter.Next() {
+			t.Fatal("next must return false, all substates were extracted")
+		}
+	})
 }
 
 func TestSubstateIterator_Value(t *testing.T) {
-	path := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(path)
-	if err != nil {
-		return
-	}
-
-	testSubstatorIterator_Value(db, t)
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		path := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(path, engine)
+		if err != nil {
+			return
+		}
+
+		testSubstatorIterator_Value(db, t)
+	})
 }
 
 func testSubstatorIterator_Value(db *substateDB, t *testing.T) {
@@ -56,82 +62,174 @@ func testSubstatorIterator_Value(db *substateDB, t *testing.T) {
 }
 
 func TestSubstateIterator_Release(t *testing.T) {
-	path := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(path)
-	if err != nil {
-		return
-	}
-
-	iter := db.NewSubstateIterator(0, 10)
-
-	// make sure Release is not blocking.
-	done := make(chan bool)
-	go func() {
-		iter.Release()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-		return
-	case <-time.After(time.Second):
-		t.Fatal("Release blocked unexpectedly")
-	}
-
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		path := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(path, engine)
+		if err != nil {
+			return
+		}
+
+		iter := db.NewSubstateIterator(0, 10)
+
+		// make sure Release is not blocking.
+		done := make(chan bool)
+		go func() {
+			iter.Release()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Second):
+			t.Fatal("Release blocked unexpectedly")
+		}
+
+	})
 }
 
 func TestSubstateIterator_FromBlock(t *testing.T) {
-	path := t.TempDir() + "test-db"
-	db, err := createDbAndPutSubstate(path)
-	if err != nil {
-		t.Fatal(err)
-	}
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		path := t.TempDir() + "test-db"
+		db, err := createDbAndPutSubstateWithEngine(path, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	test2 := *testSubstate
-	test2.Block++
+		test2 := *testSubstate
+		test2.Block++
 
-	err = db.PutSubstate(&test2)
-	if err != nil {
-		t.Fatalf("unable to put substate: %v", err)
-	}
+		err = db.PutSubstate(&test2)
+		if err != nil {
+			t.Fatalf("unable to put substate: %v", err)
+		}
 
-	iter := db.NewSubstateIterator(37_534_834, 10)
+		iter := db.NewSubstateIterator(37_534_834, 10)
 
-	if !iter.Next() {
-		t.Fatal("next must return true")
-	}
+		if !iter.Next() {
+			t.Fatal("next must return true")
+		}
 
-	ss := iter.Value()
-	if ss.Block != 37_534_834 {
-		t.Fatal("incorrect block number")
-	}
+		ss := iter.Value()
+		if ss.Block != 37_534_834 {
+			t.Fatal("incorrect block number")
+		}
 
-	counter := 1
-	for iter.Next() {
-		counter++
-	}
+		counter := 1
+		for iter.Next() {
+			counter++
+		}
 
-	if counter != 2 {
-		t.Fatal("incorrect number of substates")
-	}
+		if counter != 2 {
+			t.Fatal("incorrect number of substates")
+		}
 
-	iter2 := db.NewSubstateIterator(37_534_835, 10)
+		iter2 := db.NewSubstateIterator(37_534_835, 10)
 
-	if !iter2.Next() {
-		t.Fatal("next must return true")
-	}
+		if !iter2.Next() {
+			t.Fatal("next must return true")
+		}
 
-	ss2 := iter2.Value()
+		ss2 := iter2.Value()
 
-	if ss2 == nil {
-		t.Fatal("iterator returned nil")
-	}
+		if ss2 == nil {
+			t.Fatal("iterator returned nil")
+		}
 
-	if ss2.Block != 37_534_835 {
-		t.Fatalf("iterator returned transaction with different block number\ngot: %v\n want: %v", ss.Block, 37_534_835)
-	}
+		if ss2.Block != 37_534_835 {
+			t.Fatalf("iterator returned transaction with different block number\ngot: %v\n want: %v", ss.Block, 37_534_835)
+		}
 
-	if ss2.Transaction != 1 {
-		t.Fatalf("iterator returned transaction with different transaction number\ngot: %v\n want: %v", ss2.Transaction, 1)
-	}
+		if ss2.Transaction != 1 {
+			t.Fatalf("iterator returned transaction with different transaction number\ngot: %v\n want: %v", ss2.Transaction, 1)
+		}
+	})
+}
+
+func TestSubstateIterator_Range(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		path := t.TempDir() + "test-db"
+		db, err := newSubstateDBWithEngine(path, engine, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for block := uint64(1); block <= 4; block++ {
+			for tx := 0; tx < 2; tx++ {
+				ss := *testSubstate
+				ss.Transaction = tx
+				if err = addCustomSubstate(db, block, &ss); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		tests := []struct {
+			name string
+			r    SubstateRange
+			want []string
+		}{
+			{"inclusive", SubstateRange{FirstBlock: 2, LastBlock: 3}, []string{"2_0", "2_1", "3_0", "3_1"}},
+			{"exclusive", SubstateRange{FirstBlock: 2, LastBlock: 3, ExclusiveEnd: true}, []string{"2_0", "2_1"}},
+			{"first tx", SubstateRange{FirstBlock: 3, FirstTx: 1, LastBlock: 10}, []string{"3_1", "4_0", "4_1"}},
+			{"empty", SubstateRange{FirstBlock: 3, LastBlock: 3, ExclusiveEnd: true}, nil},
+			{"reversed", SubstateRange{FirstBlock: 4, LastBlock: 1}, nil},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				iter := db.NewSubstateRangeIterator(test.r, 2)
+				defer iter.Release()
+
+				var got []string
+				for iter.Next() {
+					ss := iter.Value()
+					got = append(got, fmt.Sprintf("%v_%v", ss.Block, ss.Transaction))
+				}
+				if err := iter.Error(); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, test.want) {
+					t.Fatalf("unexpected substates\ngot: %v\nwant: %v", got, test.want)
+				}
+			})
+		}
+	})
+}
+
+func TestSubstateIterator_Sampler(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine Engine) {
+		path := t.TempDir() + "test-db"
+		db, err := newSubstateDBWithEngine(path, engine, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for block := uint64(1); block <= 10; block++ {
+			for tx := 0; tx < 3; tx++ {
+				ss := *testSubstate
+				ss.Transaction = tx
+				if err = addCustomSubstate(db, block, &ss); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		iter := db.NewSubstateRangeIterator(SubstateRange{FirstBlock: 2, LastBlock: 9, Sampler: EveryNthBlock(3)}, 2)
+		defer iter.Release()
+
+		var got []string
+		for iter.Next() {
+			ss := iter.Value()
+			got = append(got, fmt.Sprintf("%v_%v", ss.Block, ss.Transaction))
+		}
+		if err := iter.Error(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"3_0", "3_1", "3_2", "6_0", "6_1", "6_2", "9_0", "9_1", "9_2"}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected substates\ngot: %v\nwant: %v", got, want)
+		}
+	})
 }
@@ -0,0 +1,398 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types"
+	ldbiterator "github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
+const defaultMergeBatchSize = 64 * 1024 * 1024
+
+// MergePolicy decides which substate is kept if sources contain different substates of the same transaction.
+type MergePolicy string
+
+const (
+	MergeFail      MergePolicy = "fail"       // fail the merge
+	MergeKeepFirst MergePolicy = "keep-first" // keep the substate merged first
+	MergeKeepLast  MergePolicy = "keep-last"  // keep the substate merged last
+)
+
+// MergeConfig contains options of MergeSubstateDBs.
+type MergeConfig struct {
+	Policy    MergePolicy // conflict policy; MergeFail if empty
+	BatchSize int         // number of bytes buffered before they are written into the target; 64 MiB if not positive
+}
+
+// MergeStats counts the records merged from one source.
+type MergeStats struct {
+	Substates      int64 // substates written into the target
+	Duplicates     int64 // substates equal to a substate merged before
+	Conflicts      int64 // substates different from a substate merged before
+	Codes          int64 // codes referenced by written substates and written into the target
+	DuplicateCodes int64 // codes referenced by written substates and already contained in the target
+}
+
+// MergeConflict is a substate of a source which differs from the substate merged before.
+type MergeConflict struct {
+	Block  uint64
+	Tx     int
+	Source int   // index of the source
+	Kept   bool  // true if the substate of the source replaced the one merged before
+	Diff   error // differences reported by Substate.Equal
+}
+
+// MergeReport summarizes a run of MergeSubstateDBs.
+type MergeReport struct {
+	Policy    MergePolicy
+	Sources   []MergeStats // stats of every merged source in order of the sources
+	Conflicts []MergeConflict
+}
+
+// Print writes every conflict and a summary of every source into w.
+func (r *MergeReport) Print(w io.Writer) error {
+	for _, c := range r.Conflicts {
+		action := "kept"
+		if !c.Kept {
+			action = "skipped"
+		}
+		if _, err := fmt.Fprintf(w, "conflict block %d, tx %d: %s substate of source %d; %v\n", c.Block, c.Tx, action, c.Source, c.Diff); err != nil {
+			return err
+		}
+	}
+	for i, s := range r.Sources {
+		if _, err := fmt.Fprintf(w, "source %d: merged %d substates (%d duplicates, %d conflicts) and %d codes (%d duplicates)\n",
+			i, s.Substates, s.Duplicates, s.Conflicts, s.Codes, s.DuplicateCodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeSubstateDBs merges the substates of srcs into dst in order of srcs together with the
+// codes referenced by the written substates. Codes are deduplicated by their hash. If a
+// substate of a transaction was merged before, either by an earlier source or because dst
+// contains it already, both substates are compared with Substate.Equal. Equal substates are
+// skipped; different ones are resolved by cfg.Policy and reported. Codes referenced only by
+// substates replaced under MergeKeepLast remain in dst; CollectCodeGarbage removes them.
+//
+// Under MergeFail, all sources are checked for conflicts before anything is written, hence
+// a failed merge leaves dst unchanged. The report of a failed merge contains the first
+// conflict only. The check iterates all sources once more, so MergeFail reads and decodes
+// every source twice.
+//
+// Records of sources with the encoding of dst are copied as stored, others are re-encoded
+// with the encoding and compression of dst. Records are written in batches of cfg.BatchSize
+// bytes; each source is written completely before the next one is merged.
+func MergeSubstateDBs(dst SubstateDB, srcs []SubstateDB, cfg MergeConfig) (*MergeReport, error) {
+	m := &merger{
+		dst:       dst,
+		batch:     dst.NewBatch(),
+		batchSize: cfg.BatchSize,
+		report:    &MergeReport{Policy: cfg.Policy},
+	}
+	if m.report.Policy == "" {
+		m.report.Policy = MergeFail
+	}
+	switch m.report.Policy {
+	case MergeFail, MergeKeepFirst, MergeKeepLast:
+	default:
+		return nil, fmt.Errorf("cannot merge substates; unknown conflict policy %q", cfg.Policy)
+	}
+	if m.batchSize <= 0 {
+		m.batchSize = defaultMergeBatchSize
+	}
+
+	var err error
+	if m.target, err = newSubstateEncoding(dst.GetSubstateEncoding(), dst.GetCode); err != nil {
+		return nil, fmt.Errorf("cannot merge substates; %w", err)
+	}
+	if compression := dst.GetSubstateCompression(); compression != "none" {
+		codec, err := GetSubstateCodec(compression)
+		if err != nil {
+			return nil, fmt.Errorf("cannot merge substates; %w", err)
+		}
+		m.target = m.target.withCodec(codec)
+	}
+	if err = m.batch.Put([]byte(SubstateEncodingKey), []byte(m.target.schema)); err != nil {
+		return nil, err
+	}
+
+	if m.report.Policy == MergeFail {
+		conflict, err := findMergeConflict(dst, srcs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot merge substates; %w", err)
+		}
+		if conflict != nil {
+			m.report.Conflicts = append(m.report.Conflicts, *conflict)
+			return m.report, fmt.Errorf("cannot merge source %d; conflicting substate block: %v, tx: %v; %w", conflict.Source, conflict.Block, conflict.Tx, conflict.Diff)
+		}
+	}
+
+	for i, src := range srcs {
+		m.report.Sources = append(m.report.Sources, MergeStats{})
+		if err = m.merge(i, src); err != nil {
+			return m.report, fmt.Errorf("cannot merge source %d; %w", i, err)
+		}
+	}
+	return m.report, nil
+}
+
+// findMergeConflict returns the first substate of srcs which differs from the substate of the
+// same transaction in dst or, if dst does not contain it, in the first source containing it.
+// It returns nil if srcs can be merged into dst without conflicts. The sources are iterated
+// together in order of substate keys, hence every substate record is decoded at most once.
+func findMergeConflict(dst SubstateDB, srcs []SubstateDB) (*MergeConflict, error) {
+	cursors := make([]*mergeCursor, 0, len(srcs))
+	defer func() {
+		for _, c := range cursors {
+			c.iter.Release()
+		}
+	}()
+	for i, src := range srcs {
+		source, err := newSubstateEncoding(src.GetSubstateEncoding(), src.GetCode)
+		if err != nil {
+			return nil, err
+		}
+		c := &mergeCursor{source: i, encoding: source, iter: src.NewIterator([]byte(SubstateDBPrefix), nil)}
+		cursors = append(cursors, c)
+		if err = c.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	var holders []*mergeCursor
+	for {
+		// collect the sources containing the lowest remaining key in order of sources
+		holders = holders[:0]
+		for _, c := range cursors {
+			if c.key == nil {
+				continue
+			}
+			if len(holders) > 0 {
+				cmp := bytes.Compare(c.key, holders[0].key)
+				if cmp > 0 {
+					continue
+				}
+				if cmp < 0 {
+					holders = holders[:0]
+				}
+			}
+			holders = append(holders, c)
+		}
+		if len(holders) == 0 {
+			return nil, nil
+		}
+
+		conflict, err := findSubstateConflict(dst, holders)
+		if err != nil || conflict != nil {
+			return conflict, err
+		}
+		for _, c := range holders {
+			if err = c.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// findSubstateConflict compares the substate records of the same transaction held by
+// holders with the substate of dst or, if dst does not contain it, with the record of the
+// first holder.
+func findSubstateConflict(dst SubstateDB, holders []*mergeCursor) (*MergeConflict, error) {
+	first := holders[0]
+	block, tx, err := DecodeSubstateDBKey(first.key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid substate key: %v; %w", first.key, err)
+	}
+
+	has, err := dst.HasSubstate(block, tx)
+	if err != nil {
+		return nil, err
+	}
+	var want *substate.Substate
+	if has {
+		if want, err = dst.GetSubstate(block, tx); err != nil {
+			return nil, err
+		}
+	} else {
+		if want, err = first.encoding.decode(first.value, block, tx); err != nil {
+			return nil, err
+		}
+		holders = holders[1:]
+	}
+
+	for _, c := range holders {
+		// equally encoded records of earlier sources are known to be equal to want
+		if !has && c.encoding.schema == first.encoding.schema && bytes.Equal(c.value, first.value) {
+			continue
+		}
+		ss, err := c.encoding.decode(c.value, block, tx)
+		if err != nil {
+			return nil, err
+		}
+		if diff := want.Equal(ss); diff != nil {
+			return &MergeConflict{Block: block, Tx: tx, Source: c.source, Diff: diff}, nil
+		}
+	}
+	return nil, nil
+}
+
+// mergeCursor iterates the substate records of a source in order of their keys.
+type mergeCursor struct {
+	source   int // index of the source
+	encoding *substateEncoding
+	iter     ldbiterator.Iterator
+	key      []byte // key of the current record; nil once the source is exhausted
+	value    []byte
+}
+
+// next moves the cursor to the next record of the source.
+func (c *mergeCursor) next() error {
+	if c.iter.Next() {
+		c.key, c.value = c.iter.Key(), c.iter.Value()
+		return nil
+	}
+	c.key, c.value = nil, nil
+	if err := c.iter.Error(); err != nil {
+		return fmt.Errorf("cannot iterate substates of source %d; %w", c.source, err)
+	}
+	return nil
+}
+
+// merger buffers merged records in a batch.
+type merger struct {
+	dst        SubstateDB
+	target     *substateEncoding
+	batch      Batch
+	batchSize  int
+	references []types.Hash            // codes referenced by the last decoded substate
+	merged     map[types.Hash]struct{} // codes of the current source already merged or found in dst
+	report     *MergeReport
+}
+
+// merge merges the substates of the i-th source src together with the codes they reference.
+func (m *merger) merge(i int, src SubstateDB) error {
+	// decoding looks up every referenced code hash
+	source, err := newSubstateEncoding(src.GetSubstateEncoding(), func(codeHash types.Hash) ([]byte, error) {
+		m.references = append(m.references, codeHash)
+		return src.GetCode(codeHash)
+	})
+	if err != nil {
+		return err
+	}
+	m.merged = make(map[types.Hash]struct{})
+
+	iter := src.NewIterator([]byte(SubstateDBPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		block, tx, err := DecodeSubstateDBKey(iter.Key())
+		if err != nil {
+			return fmt.Errorf("invalid substate key: %v; %w", iter.Key(), err)
+		}
+		if err = m.mergeSubstate(i, src, source, iter.Value(), block, tx); err != nil {
+			return err
+		}
+	}
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("cannot iterate substates; %w", err)
+	}
+	// substates must be written before they are compared with substates of later sources
+	return m.flush()
+}
+
+// mergeSubstate merges the substate record of the i-th source and the codes it references
+// unless dst contains an equal substate or the conflict policy keeps the substate of dst.
+func (m *merger) mergeSubstate(i int, src SubstateDB, source *substateEncoding, value []byte, block uint64, tx int) error {
+	stats := &m.report.Sources[i]
+	m.references = m.references[:0]
+	ss, err := source.decode(value, block, tx)
+	if err != nil {
+		return err
+	}
+
+	has, err := m.dst.HasSubstate(block, tx)
+	if err != nil {
+		return err
+	}
+	if has {
+		merged, err := m.dst.GetSubstate(block, tx)
+		if err != nil {
+			return err
+		}
+		diff := merged.Equal(ss)
+		if diff == nil {
+			stats.Duplicates++
+			return nil
+		}
+
+		stats.Conflicts++
+		policy := m.report.Policy
+		m.report.Conflicts = append(m.report.Conflicts, MergeConflict{Block: block, Tx: tx, Source: i, Kept: policy == MergeKeepLast, Diff: diff})
+		switch policy {
+		case MergeFail:
+			return fmt.Errorf("conflicting substate block: %v, tx: %v; %w", block, tx, diff)
+		case MergeKeepFirst:
+			return nil
+		}
+	}
+
+	for _, codeHash := range m.references {
+		if err = m.putCode(i, src, codeHash); err != nil {
+			return fmt.Errorf("cannot merge code of substate block: %v, tx: %v; %w", block, tx, err)
+		}
+	}
+	if source.schema != m.target.schema {
+		if value, err = m.target.encode(ss, block, tx); err != nil {
+			return fmt.Errorf("cannot encode substate block: %v, tx: %v; %w", block, tx, err)
+		}
+	}
+	stats.Substates++
+	return m.put(SubstateDBKey(block, tx), value)
+}
+
+// putCode puts the code of given hash read from src unless it was merged already or dst
+// contains it.
+func (m *merger) putCode(i int, src CodeDB, codeHash types.Hash) error {
+	if _, ok := m.merged[codeHash]; ok {
+		return nil
+	}
+	m.merged[codeHash] = struct{}{}
+	stats := &m.report.Sources[i]
+	has, err := m.dst.HasCode(codeHash)
+	if err != nil {
+		return err
+	}
+	if has {
+		stats.DuplicateCodes++
+		return nil
+	}
+	code, err := src.GetCode(codeHash)
+	if err != nil {
+		return err
+	}
+	stats.Codes++
+	return m.put(CodeDBKey(codeHash), code)
+}
+
+// put puts the record into the batch and writes the batch once it exceeds the batch size.
+func (m *merger) put(key, value []byte) error {
+	if err := m.batch.Put(key, value); err != nil {
+		return err
+	}
+	if m.batch.ValueSize() < m.batchSize {
+		return nil
+	}
+	return m.flush()
+}
+
+func (m *merger) flush() error {
+	if err := m.batch.Write(); err != nil {
+		return fmt.Errorf("cannot write batch; %w", err)
+	}
+	m.batch.Reset()
+	return nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types"
+)
+
+// newConflictingTestSubstate returns the substate of given block and tx differing from
+// newTestSubstate by its result and by an input account of its own code.
+func newConflictingTestSubstate(block uint64, tx int) *substate.Substate {
+	ss := newTestSubstate(block, tx)
+	res := *ss.Result
+	res.GasUsed++
+	ss.Result = &res
+	ss.InputSubstate = substate.WorldState{
+		types.Address{1}: substate.NewAccount(1, big.NewInt(1), []byte("conflicting code")),
+	}
+	return ss
+}
+
+func TestMergeSubstateDBs_MergesOverlappingSources(t *testing.T) {
+	dst := createTestSubstateDB(t, "rlp", 1, 0, 0)
+	first := createTestSubstateDB(t, "rlp", 1, 3, 2)
+	second := createTestSubstateDB(t, "protobuf", 1, 5, 2)
+
+	report, err := MergeSubstateDBs(dst, []SubstateDB{first, second}, MergeConfig{BatchSize: 1})
+	require.NoError(t, err)
+	require.Empty(t, report.Conflicts)
+	require.Len(t, report.Sources, 2)
+	require.Equal(t, int64(6), report.Sources[0].Substates)
+	require.Equal(t, int64(4), report.Sources[1].Substates)
+	require.Equal(t, int64(6), report.Sources[1].Duplicates)
+	require.Equal(t, int64(14), report.Sources[0].Codes)
+	// only codes of substates of blocks 4 and 5 are merged
+	require.Equal(t, int64(10), report.Sources[1].Codes)
+
+	require.Equal(t, "rlp", dst.GetSubstateEncoding())
+	requireSameSubstates(t, second, dst, 1, 5, 2)
+
+	var out bytes.Buffer
+	require.NoError(t, report.Print(&out))
+	require.Contains(t, out.String(), "source 1: merged 4 substates (6 duplicates, 0 conflicts)")
+}
+
+func TestMergeSubstateDBs_ResolvesConflictsByPolicy(t *testing.T) {
+	for _, policy := range []MergePolicy{MergeKeepFirst, MergeKeepLast} {
+		t.Run(string(policy), func(t *testing.T) {
+			dst := createTestSubstateDB(t, "protobuf", 1, 0, 0)
+			first := createTestSubstateDB(t, "rlp", 1, 3, 2)
+			second := createTestSubstateDB(t, "rlp", 1, 3, 2)
+			require.NoError(t, second.PutSubstate(newConflictingTestSubstate(2, 0)))
+
+			report, err := MergeSubstateDBs(dst, []SubstateDB{first, second}, MergeConfig{Policy: policy})
+			require.NoError(t, err)
+			require.Len(t, report.Conflicts, 1)
+			conflict := report.Conflicts[0]
+			require.Equal(t, uint64(2), conflict.Block)
+			require.Equal(t, 0, conflict.Tx)
+			require.Equal(t, 1, conflict.Source)
+			require.Equal(t, policy == MergeKeepLast, conflict.Kept)
+			require.ErrorContains(t, conflict.Diff, "GasUsed")
+			require.Equal(t, int64(1), report.Sources[1].Conflicts)
+			require.Equal(t, int64(5), report.Sources[1].Duplicates)
+
+			kept := SubstateDB(first)
+			if policy == MergeKeepLast {
+				kept = second
+			}
+			requireSameSubstates(t, kept, dst, 1, 3, 2)
+
+			// codes of skipped substates are not merged
+			if policy == MergeKeepFirst {
+				gc, err := CollectCodeGarbage(dst, CodeGCConfig{})
+				require.NoError(t, err)
+				require.Empty(t, gc.Orphaned)
+			}
+
+			var out bytes.Buffer
+			require.NoError(t, report.Print(&out))
+			require.Contains(t, out.String(), "conflict block 2, tx 0: ")
+		})
+	}
+}
+
+func TestMergeSubstateDBs_FailsOnConflictByDefault(t *testing.T) {
+	dst := createTestSubstateDB(t, "rlp", 4, 4, 1)
+	before := dumpRecords(t, dst)
+	second := createTestSubstateDB(t, "rlp", 1, 3, 2)
+	require.NoError(t, second.PutSubstate(newConflictingTestSubstate(2, 0)))
+
+	report, err := MergeSubstateDBs(dst, []SubstateDB{createTestSubstateDB(t, "rlp", 1, 3, 2), second}, MergeConfig{BatchSize: 1})
+	require.ErrorContains(t, err, "cannot merge source 1; conflicting substate block: 2, tx: 0")
+	require.Equal(t, MergeFail, report.Policy)
+	require.Len(t, report.Conflicts, 1)
+	require.Equal(t, 1, report.Conflicts[0].Source)
+	require.False(t, report.Conflicts[0].Kept)
+
+	// neither codes nor substates of the first source are written
+	require.Equal(t, before, dumpRecords(t, dst))
+}
+
+func TestMergeSubstateDBs_FailsOnConflictWithTarget(t *testing.T) {
+	dst := createTestSubstateDB(t, "protobuf", 1, 0, 0)
+	require.NoError(t, dst.PutSubstate(newConflictingTestSubstate(3, 1)))
+	before := dumpRecords(t, dst)
+
+	_, err := MergeSubstateDBs(dst, []SubstateDB{createTestSubstateDB(t, "rlp", 1, 3, 2)}, MergeConfig{})
+	require.ErrorContains(t, err, "cannot merge source 0; conflicting substate block: 3, tx: 1")
+	require.Equal(t, before, dumpRecords(t, dst))
+}
+
+// dumpRecords returns every key and value stored in db.
+func dumpRecords(t *testing.T, db SubstateDB) map[string]string {
+	records := make(map[string]string)
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		records[string(iter.Key())] = string(iter.Value())
+	}
+	require.NoError(t, iter.Error())
+	return records
+}
+
+func TestMergeSubstateDBs_RejectsUnknownPolicy(t *testing.T) {
+	_, err := MergeSubstateDBs(createTestSubstateDB(t, "rlp", 1, 0, 0), nil, MergeConfig{Policy: "keep-both"})
+	require.ErrorContains(t, err, `unknown conflict policy "keep-both"`)
+}
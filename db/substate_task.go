@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"runtime"
 	"sort"
@@ -30,8 +32,132 @@ var (
 		Name:  "skip-create-txs",
 		Usage: "Skip executing CREATE transactions",
 	}
+	ContinueOnErrorFlag = cli.BoolFlag{
+		Name:  "continue-on-error",
+		Usage: "Continue executing after failed transactions and report all failures at the end",
+	}
+	MaxErrorsFlag = cli.IntFlag{
+		Name:  "max-errors",
+		Usage: "Maximum number of failures collected with --continue-on-error before aborting (0 = unlimited)",
+	}
+	ParallelTxsFlag = cli.BoolFlag{
+		Name:  "parallel-txs",
+		Usage: "Execute transactions of a block in parallel instead of one after another",
+	}
+	FilterFlag = cli.StringFlag{
+		Name:  "filter",
+		Usage: "Execute only transactions matching given expression, e.g. \"!transfer && (failed || gas > 100000)\"; see ParseSubstateFilter",
+		Action: func(_ *cli.Context, expr string) error {
+			_, err := ParseSubstateFilter(expr)
+			return err
+		},
+	}
+	SampleFlag = cli.StringFlag{
+		Name:  "sample",
+		Usage: "Execute only a sample of blocks: every=<n>, random=<fraction> or stratified=<size>/<count>",
+		Action: func(_ *cli.Context, spec string) error {
+			_, err := ParseBlockSampler(spec, 0)
+			return err
+		},
+	}
+	SampleSeedFlag = cli.Int64Flag{
+		Name:  "sample-seed",
+		Usage: "Seed of random and stratified samples",
+	}
+	CheckpointFlag = cli.PathFlag{
+		Name:  "checkpoint",
+		Usage: "File where progress is periodically saved and from which an interrupted run is resumed",
+	}
 )
 
+// TaskPoolConfig contains options of a SubstateTaskPool.
+type TaskPoolConfig struct {
+	Workers         int  // number of worker threads; WorkersFlag default is used if not positive
+	SkipTransferTxs bool // skip transactions that only transfer ETH
+	SkipCallTxs     bool // skip CALL transactions to accounts with contract bytecode
+	SkipCreateTxs   bool // skip CREATE transactions
+
+	Filter  SubstateFilter // optional; only transactions selected by the filter are executed
+	Sampler BlockSampler   // optional; only blocks selected by the sampler are executed
+
+	ParallelTxs     bool // schedule transactions of a block across workers instead of executing them one after another
+	ContinueOnError bool // collect failures into an ErrorReport instead of aborting on the first one
+	MaxErrors       int  // number of failures after which a ContinueOnError run is aborted; unlimited if not positive
+
+	Checkpoint         Checkpointer  // optional; saves progress and resumes interrupted runs
+	CheckpointInterval time.Duration // minimal time between two checkpoints; 10s if not positive
+
+	Progress ProgressReporter // optional; progress is printed to stdout if nil
+	Metrics  *Metrics         // optional; records counters and latencies of the execution
+}
+
+// NewTaskPoolConfigFromCli creates a TaskPoolConfig from WorkersFlag, SkipTransferTxsFlag,
+// SkipCallTxsFlag, SkipCreateTxsFlag, FilterFlag, SampleFlag, SampleSeedFlag, ParallelTxsFlag,
+// ContinueOnErrorFlag, MaxErrorsFlag and CheckpointFlag of given CLI context.
+func NewTaskPoolConfigFromCli(ctx *cli.Context) (TaskPoolConfig, error) {
+	cfg := TaskPoolConfig{
+		Workers:         ctx.Int(WorkersFlag.Name),
+		SkipTransferTxs: ctx.Bool(SkipTransferTxsFlag.Name),
+		SkipCallTxs:     ctx.Bool(SkipCallTxsFlag.Name),
+		SkipCreateTxs:   ctx.Bool(SkipCreateTxsFlag.Name),
+		ParallelTxs:     ctx.Bool(ParallelTxsFlag.Name),
+		ContinueOnError: ctx.Bool(ContinueOnErrorFlag.Name),
+		MaxErrors:       ctx.Int(MaxErrorsFlag.Name),
+	}
+	if expr := ctx.String(FilterFlag.Name); expr != "" {
+		filter, err := ParseSubstateFilter(expr)
+		if err != nil {
+			return TaskPoolConfig{}, err
+		}
+		cfg.Filter = filter
+	}
+	if spec := ctx.String(SampleFlag.Name); spec != "" {
+		sampler, err := ParseBlockSampler(spec, ctx.Int64(SampleSeedFlag.Name))
+		if err != nil {
+			return TaskPoolConfig{}, err
+		}
+		cfg.Sampler = sampler
+	}
+	if path := ctx.Path(CheckpointFlag.Name); path != "" {
+		cfg.Checkpoint = NewFileCheckpointer(path)
+	}
+	return cfg, nil
+}
+
+// NewSubstateTaskPool creates a SubstateTaskPool executing taskFunc on substates of db from block first to last.
+func NewSubstateTaskPool(name string, taskFunc SubstateTaskFunc, first, last uint64, cfg TaskPoolConfig, db SubstateDB) *SubstateTaskPool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = WorkersFlag.Value
+	}
+
+	return &SubstateTaskPool{
+		Name:     name,
+		TaskFunc: taskFunc,
+
+		First: first,
+		Last:  last,
+
+		Workers:         cfg.Workers,
+		SkipTransferTxs: cfg.SkipTransferTxs,
+		SkipCallTxs:     cfg.SkipCallTxs,
+		SkipCreateTxs:   cfg.SkipCreateTxs,
+		Filter:          cfg.Filter,
+		Sampler:         cfg.Sampler,
+
+		ParallelTxs:     cfg.ParallelTxs,
+		ContinueOnError: cfg.ContinueOnError,
+		MaxErrors:       cfg.MaxErrors,
+
+		Checkpoint:         cfg.Checkpoint,
+		CheckpointInterval: cfg.CheckpointInterval,
+
+		Progress: cfg.Progress,
+		Metrics:  cfg.Metrics,
+
+		DB: db,
+	}
+}
+
 type SubstateBlockFunc func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error
 type SubstateTaskFunc func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error
 
@@ -47,28 +173,90 @@ type SubstateTaskPool struct {
 	SkipTransferTxs bool
 	SkipCallTxs     bool
 	SkipCreateTxs   bool
+	Filter          SubstateFilter // optional; transactions not selected by the filter are skipped
+	Sampler         BlockSampler   // optional; blocks not selected by the sampler are skipped
+
+	// ParallelTxs schedules transactions of a block as separate tasks across workers.
+	// BlockFunc of a block is still called before any of its transactions and a block
+	// is completed, and counted, only once all its transactions are finished.
+	ParallelTxs bool
+
+	ContinueOnError bool // failures are collected and returned as *ErrorReport once all blocks are executed
+	MaxErrors       int  // ContinueOnError run is aborted after this many failures; unlimited if not positive
+
+	Checkpoint         Checkpointer  // optional; last block completed in order is saved and a rerun resumes after it
+	CheckpointInterval time.Duration // minimal time between two checkpoints
 
-	Ctx *cli.Context // CLI context required to read additional flags
+	Progress ProgressReporter // receives progress of Execute; DefaultProgressReporter is used if nil
+	Metrics  *Metrics         // optional; records counters and latencies of Execute including substate decoding
+
+	Ctx *cli.Context // optional CLI context for task functions reading additional flags
 
 	DB SubstateDB
+
+	errors    *errorCollector // failures of the current ContinueOnError execution
+	configErr error           // invalid CLI configuration; returned by every execution
+}
+
+// collectError records a failure if the pool collects errors. Otherwise, or if too many
+// failures were collected, it returns the error which aborts the execution.
+func (pool *SubstateTaskPool) collectError(e TaskError, err error) error {
+	if pool.errors == nil {
+		return err
+	}
+	if cErr := pool.errors.add(e); cErr != nil {
+		return fmt.Errorf("%s: %w", pool.Name, cErr)
+	}
+	return nil
 }
 
 // ExecuteBlock function iterates on substates of a given block call TaskFunc
 func (pool *SubstateTaskPool) ExecuteBlock(block uint64) (numTx int64, gas int64, err error) {
-	transactions, err := pool.DB.GetBlockSubstates(block)
+	if pool.configErr != nil {
+		return 0, 0, pool.configErr
+	}
+	transactions, txNumbers, err := pool.prepareBlock(block)
 	if err != nil {
 		return 0, 0, err
 	}
+	if pool.TaskFunc == nil {
+		return int64(len(transactions)), 0, nil
+	}
+
+	for _, tx := range txNumbers {
+		executed, err := pool.executeTx(block, tx, transactions[tx])
+		if err != nil {
+			return 0, 0, err
+		}
+		if executed {
+			numTx++
+			gas += int64(transactions[tx].Result.GasUsed)
+		}
+	}
+
+	return numTx, gas, nil
+}
+
+// prepareBlock reads substates of a given block, calls BlockFunc and returns the
+// substates together with their sorted transaction numbers.
+func (pool *SubstateTaskPool) prepareBlock(block uint64) (map[int]*substate.Substate, []int, error) {
+	var transactions map[int]*substate.Substate
+	var err error
+	if r, ok := pool.DB.(meteredBlockReader); ok && pool.Metrics != nil {
+		transactions, err = r.getBlockSubstates(block, pool.Metrics)
+	} else {
+		transactions, err = pool.DB.GetBlockSubstates(block)
+	}
+	if err != nil {
+		return nil, nil, pool.collectError(TaskError{Block: block, Tx: -1, Err: err}, err)
+	}
 
 	if pool.BlockFunc != nil {
 		err := pool.BlockFunc(block, transactions, pool)
 		if err != nil {
-			return 0, 0, fmt.Errorf("%s: block %v: %w", pool.Name, block, err)
+			return nil, nil, pool.collectError(TaskError{Block: block, Tx: -1, Err: err}, fmt.Errorf("%s: block %v: %w", pool.Name, block, err))
 		}
 	}
-	if pool.TaskFunc == nil {
-		return int64(len(transactions)), 0, nil
-	}
 
 	// Fix the order in which transactions are processed in a block
 	// such that in cases where only a single worker is processing
@@ -79,58 +267,164 @@ func (pool *SubstateTaskPool) ExecuteBlock(block uint64) (numTx int64, gas int64
 	}
 	sort.Slice(txNumbers, func(i, j int) bool { return txNumbers[i] < txNumbers[j] })
 
-	for _, tx := range txNumbers {
-		substate := transactions[tx]
-		alloc := substate.InputSubstate
-		msg := substate.Message
-
-		to := msg.To
-		if pool.SkipTransferTxs && to != nil {
-			// skip regular transactions (ETH transfer)
-			if account, exist := alloc[*to]; !exist || len(account.Code) == 0 {
-				continue
-			}
-		}
-		if pool.SkipCallTxs && to != nil {
-			// skip CALL trasnactions with contract bytecode
-			if account, exist := alloc[*to]; exist && len(account.Code) > 0 {
-				continue
-			}
-		}
-		if pool.SkipCreateTxs && to == nil {
-			// skip CREATE transactions
-			continue
-		}
-		err = pool.TaskFunc(block, tx, substate, pool)
+	return transactions, txNumbers, nil
+}
+
+// executeTx calls TaskFunc on given substate unless it is skipped. It returns whether the TaskFunc was called.
+func (pool *SubstateTaskPool) executeTx(block uint64, tx int, substate *substate.Substate) (bool, error) {
+	if !pool.selects(substate) {
+		return false, nil
+	}
+	err := pool.TaskFunc(block, tx, substate, pool)
+	if err != nil {
+		err = pool.collectError(TaskError{Block: block, Tx: tx, Err: err}, fmt.Errorf("%s: %v_%v: %w", pool.Name, block, tx, err))
 		if err != nil {
-			return 0, 0, fmt.Errorf("%s: %v_%v: %w", pool.Name, block, tx, err)
+			return false, err
 		}
+	}
+	return true, nil
+}
 
-		numTx++
-		gas += int64(substate.Result.GasUsed)
+// selects reports whether a substate passes the Skip*Txs flags and the Filter of the pool.
+func (pool *SubstateTaskPool) selects(ss *substate.Substate) bool {
+	if pool.SkipTransferTxs && IsTransferTx(ss) {
+		return false
+	}
+	if pool.SkipCallTxs && IsCallTx(ss) {
+		return false
 	}
+	if pool.SkipCreateTxs && IsCreateTx(ss) {
+		return false
+	}
+	return pool.Filter == nil || pool.Filter(ss)
+}
 
-	return numTx, gas, nil
+// sampled reports whether a block is selected by the Sampler of the pool.
+func (pool *SubstateTaskPool) sampled(block uint64) bool {
+	return pool.Sampler == nil || pool.Sampler(block)
+}
+
+// parallelBlock tracks a block whose transactions are executed concurrently in ParallelTxs mode.
+type parallelBlock struct {
+	number  uint64
+	start   time.Time
+	pending atomic.Int64 // transactions not finished yet
+	numTx   atomic.Int64
+	gas     atomic.Int64
+
+	lock sync.Mutex
+	err  error // first failure of the block's transactions
+}
+
+func (b *parallelBlock) setErr(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *parallelBlock) getErr() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.err
+}
+
+// txTask is a single transaction of a parallelBlock.
+type txTask struct {
+	block    *parallelBlock
+	tx       int
+	substate *substate.Substate
 }
 
 // Execute function spawns worker goroutines and schedule tasks.
 func (pool *SubstateTaskPool) Execute() error {
+	return pool.ExecuteContext(context.Background())
+}
+
+// ExecuteContext function spawns worker goroutines and schedule tasks until all blocks
+// are executed or ctx is done. Once ctx is done no more blocks are scheduled, blocks
+// in progress are finished and ctx.Err() is returned.
+//
+// If Checkpoint is set, execution resumes after the checkpointed block and the last
+// block completed in order is saved periodically and when execution stops. A checkpoint
+// saved by a pool of another block range is rejected with ErrCheckpointMismatch. With
+// ContinueOnError, the checkpoint stops before the first failed block, hence a resumed
+// run executes failed blocks again.
+func (pool *SubstateTaskPool) ExecuteContext(ctx context.Context) (err error) {
+	if pool.configErr != nil {
+		return pool.configErr
+	}
+	first := pool.First
+	var checkpoint *checkpointWriter
+	if pool.Checkpoint != nil {
+		cp, ok, err := pool.Checkpoint.LoadCheckpoint()
+		if err != nil {
+			return fmt.Errorf("%s: cannot load checkpoint; %w", pool.Name, err)
+		}
+		if ok && (cp.First != pool.First || cp.Last != pool.Last) {
+			return fmt.Errorf("%s: %w; checkpoint of blocks %v-%v cannot resume blocks %v-%v", pool.Name, ErrCheckpointMismatch, cp.First, cp.Last, pool.First, pool.Last)
+		}
+		if ok && cp.Block >= first {
+			// the whole range is already completed
+			if cp.Block >= pool.Last {
+				return nil
+			}
+			first = cp.Block + 1
+		}
+
+		checkpoint = newCheckpointWriter(pool.Checkpoint, pool.CheckpointInterval, pool.First, pool.Last)
+		defer func() {
+			if cErr := checkpoint.flush(); cErr != nil {
+				err = errors.Join(err, fmt.Errorf("%s: cannot save checkpoint; %w", pool.Name, cErr))
+			}
+		}()
+	}
+
+	if pool.ContinueOnError {
+		pool.errors = newErrorCollector(pool.MaxErrors)
+		defer func() {
+			report := pool.errors.report()
+			pool.errors = nil
+			if report == nil {
+				return
+			}
+			if err == nil || errors.Is(err, ErrTooManyErrors) {
+				err = report
+			} else {
+				err = errors.Join(err, report)
+			}
+		}()
+	}
+
 	start := time.Now()
 
+	reporter := pool.Progress
+	if reporter == nil {
+		reporter = DefaultProgressReporter()
+	}
+
+	pool.Metrics.recordWatermark(first)
+
 	var totalNumBlock, totalNumTx, totalGas atomic.Int64
+	var watermark atomic.Uint64
+	watermark.Store(first)
+	progress := func() TaskPoolProgress {
+		return TaskPoolProgress{
+			Name:      pool.Name,
+			First:     first,
+			Last:      pool.Last,
+			Workers:   pool.Workers,
+			Sampled:   pool.Sampler != nil,
+			Watermark: watermark.Load(),
+			Elapsed:   time.Since(start) + 1*time.Nanosecond,
+			NumBlocks: totalNumBlock.Load(),
+			NumTxs:    totalNumTx.Load(),
+			Gas:       totalGas.Load(),
+		}
+	}
 	defer func() {
-		duration := time.Since(start) + 1*time.Nanosecond
-		sec := duration.Seconds()
-
-		nb, nt, ng := totalNumBlock.Load(), totalNumTx.Load(), totalGas.Load()
-		blkPerSec := float64(nb) / sec
-		txPerSec := float64(nt) / sec
-		gasPerSec := float64(ng) / sec
-		fmt.Printf("%s: block range = %v %v\n", pool.Name, pool.First, pool.Last)
-		fmt.Printf("%s: total #block = %v\n", pool.Name, nb)
-		fmt.Printf("%s: total #tx    = %v\n", pool.Name, nt)
-		fmt.Printf("%s: %.2f blk/s, %.2f tx/s, %.2f Mgas/s\n", pool.Name, blkPerSec, txPerSec, gasPerSec/1e6)
-		fmt.Printf("%s done in %v\n", pool.Name, duration.Round(1*time.Millisecond))
+		reporter.Finish(progress())
 	}()
 
 	// numProcs = numWorker + work producer (1) + main thread (1)
@@ -139,25 +433,57 @@ func (pool *SubstateTaskPool) Execute() error {
 		runtime.GOMAXPROCS(numProcs)
 	}
 
-	fmt.Printf("%s: block range = %v %v\n", pool.Name, pool.First, pool.Last)
-	fmt.Printf("%s: #CPU = %v, #worker = %v\n", pool.Name, runtime.NumCPU(), pool.Workers)
+	reporter.Start(progress())
 
 	workChan := make(chan uint64, pool.Workers*10)
 	doneChan := make(chan interface{}, pool.Workers*10)
-	stopChan := make(chan struct{}, pool.Workers)
+	stopChan := make(chan struct{})
 	wg := sync.WaitGroup{}
 	defer func() {
-		// stop all workers
-		for i := 0; i < pool.Workers; i++ {
-			stopChan <- struct{}{}
-		}
-		// stop work producer (1)
-		stopChan <- struct{}{}
+		// stop all workers and work producer (1)
+		close(stopChan)
 
 		wg.Wait()
 		close(workChan)
 		close(doneChan)
 	}()
+	// finishBlock accounts an executed block and reports it as done;
+	// it returns false if the execution was stopped meanwhile
+	finishBlock := func(block uint64, nt, ng int64, err error, blockStart time.Time) bool {
+		pool.Metrics.recordBlock(nt, ng, time.Since(blockStart))
+		totalGas.Add(ng)
+		totalNumTx.Add(nt)
+		totalNumBlock.Add(1)
+
+		var res interface{} = block
+		if err != nil {
+			res = err
+		}
+		select {
+		case doneChan <- res:
+			return true
+		case <-stopChan:
+			return false
+		}
+	}
+
+	// transactions of blocks dispatched in ParallelTxs mode
+	txChan := make(chan txTask, pool.Workers*10)
+	runTx := func(task txTask) bool {
+		b := task.block
+		executed, err := pool.executeTx(b.number, task.tx, task.substate)
+		if err != nil {
+			b.setErr(err)
+		} else if executed {
+			b.numTx.Add(1)
+			b.gas.Add(int64(task.substate.Result.GasUsed))
+		}
+		if b.pending.Add(-1) > 0 {
+			return true
+		}
+		return finishBlock(b.number, b.numTx.Load(), b.gas.Load(), b.getErr(), b.start)
+	}
+
 	// dynamically schedule one block per worker
 	for i := 0; i < pool.Workers; i++ {
 		wg.Add(1)
@@ -166,17 +492,56 @@ func (pool *SubstateTaskPool) Execute() error {
 			defer wg.Done()
 
 			for {
+				// prioritize stopping over picking up more work
+				// and finishing dispatched blocks over starting new ones
+				select {
+				case <-stopChan:
+					return
+				case task := <-txChan:
+					if !runTx(task) {
+						return
+					}
+					continue
+				default:
+				}
+
 				select {
 
+				case task := <-txChan:
+					if !runTx(task) {
+						return
+					}
+
 				case block := <-workChan:
-					nt, ng, err := pool.ExecuteBlock(block)
-					totalGas.Add(ng)
-					totalNumTx.Add(nt)
-					totalNumBlock.Add(1)
-					if err != nil {
-						doneChan <- err
-					} else {
-						doneChan <- block
+					blockStart := time.Now()
+					if !pool.ParallelTxs {
+						nt, ng, err := pool.ExecuteBlock(block)
+						if !finishBlock(block, nt, ng, err, blockStart) {
+							return
+						}
+						continue
+					}
+
+					transactions, txNumbers, err := pool.prepareBlock(block)
+					if err != nil || pool.TaskFunc == nil || len(txNumbers) == 0 {
+						if !finishBlock(block, int64(len(transactions)), 0, err, blockStart) {
+							return
+						}
+						continue
+					}
+
+					b := &parallelBlock{number: block, start: blockStart}
+					b.pending.Store(int64(len(txNumbers)))
+					for _, tx := range txNumbers {
+						task := txTask{block: b, tx: tx, substate: transactions[tx]}
+						select {
+						case txChan <- task:
+						default:
+							// queue is full, execute the transaction right away
+							if !runTx(task) {
+								return
+							}
+						}
 					}
 
 				case <-stopChan:
@@ -192,7 +557,10 @@ func (pool *SubstateTaskPool) Execute() error {
 	go func() {
 		defer wg.Done()
 
-		for block := pool.First; block <= pool.Last; block++ {
+		for block := first; block <= pool.Last; block++ {
+			if !pool.sampled(block) {
+				continue
+			}
 			select {
 
 			case workChan <- block:
@@ -201,43 +569,59 @@ func (pool *SubstateTaskPool) Execute() error {
 			case <-stopChan:
 				return
 
+			case <-ctx.Done():
+				return
+
 			}
 		}
 	}()
 
 	// Count finished blocks in order and report execution speed
 	var lastSec float64
-	var lastNumBlock, lastNumTx, lastGas int64
+	var failed bool
 	waitMap := make(map[uint64]struct{})
-	for block := pool.First; block <= pool.Last; {
+	for block := first; block <= pool.Last; {
 
-		// Count finshed blocks from waitMap in order
-		if _, ok := waitMap[block]; ok {
+		// Count finshed and not sampled blocks from waitMap in order
+		if _, ok := waitMap[block]; ok || !pool.sampled(block) {
 			delete(waitMap, block)
 
+			// the checkpoint stops before the first failed block, so a rerun executes it again
+			failed = failed || pool.errors.hasFailed(block)
+			if !failed {
+				if err := checkpoint.update(block); err != nil {
+					return fmt.Errorf("%s: cannot save checkpoint; %w", pool.Name, err)
+				}
+			}
+
 			block++
+			watermark.Store(block)
+			pool.Metrics.recordWatermark(block)
 			continue
 		}
 
-		duration := time.Since(start) + 1*time.Nanosecond
-		sec := duration.Seconds()
+		sec := time.Since(start).Seconds()
 		if block == pool.Last ||
 			(block%10000 == 0 && sec > lastSec+5) ||
 			(block%1000 == 0 && sec > lastSec+10) ||
 			(block%100 == 0 && sec > lastSec+20) ||
 			(block%10 == 0 && sec > lastSec+40) ||
 			(sec > lastSec+60) {
-			nb, nt, ng := totalNumBlock.Load(), totalNumTx.Load(), totalGas.Load()
-			blkPerSec := float64(nb-lastNumBlock) / (sec - lastSec)
-			txPerSec := float64(nt-lastNumTx) / (sec - lastSec)
-			gasPerSec := float64(ng-lastGas) / (sec - lastSec)
-			fmt.Printf("%s: elapsed time: %v, number = %v\n", pool.Name, duration.Round(1*time.Millisecond), block)
-			fmt.Printf("%s: %.2f blk/s, %.2f tx/s, %.2f Mgas/s\n", pool.Name, blkPerSec, txPerSec, gasPerSec/1e6)
-
-			lastSec, lastNumBlock, lastNumTx, lastGas = sec, nb, nt, ng
+			reporter.Progress(progress())
+			lastSec = sec
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var data interface{}
+		select {
+		case data = <-doneChan:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 
-		data := <-doneChan
 		switch t := data.(type) {
 
 		case uint64:
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrTooManyErrors is returned by a SubstateTaskPool running with ContinueOnError once MaxErrors failures were collected.
+var ErrTooManyErrors = errors.New("too many errors")
+
+// TaskError is a failure of a single transaction, or of a whole block if Tx is negative.
+type TaskError struct {
+	Block uint64
+	Tx    int
+	Err   error
+}
+
+func (e TaskError) Error() string {
+	if e.Tx < 0 {
+		return fmt.Sprintf("block %v: %v", e.Block, e.Err)
+	}
+	return fmt.Sprintf("%v_%v: %v", e.Block, e.Tx, e.Err)
+}
+
+func (e TaskError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorReport aggregates the failures collected by a SubstateTaskPool running with ContinueOnError.
+type ErrorReport struct {
+	// Errors contains every failure ordered by block and transaction.
+	Errors []TaskError
+
+	// Counts contains the number of failures per error kind as returned by
+	// errorKinds. A failure joining errors of several kinds counts for each kind.
+	Counts map[string]int
+
+	// Aborted is true if execution stopped after MaxErrors failures.
+	Aborted bool
+}
+
+func (r *ErrorReport) Error() string {
+	types := make([]string, 0, len(r.Counts))
+	for t := range r.Counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d failed tasks", len(r.Errors))
+	if r.Aborted {
+		b.WriteString(" (aborted)")
+	}
+	for _, t := range types {
+		fmt.Fprintf(&b, ", %s: %d", t, r.Counts[t])
+	}
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(&b, "; first: %v", r.Errors[0])
+	}
+	return b.String()
+}
+
+func (r *ErrorReport) Unwrap() []error {
+	errs := make([]error, len(r.Errors))
+	for i, e := range r.Errors {
+		errs[i] = e
+	}
+	return errs
+}
+
+var (
+	plainErrorType = reflect.TypeOf(errors.New(""))
+	wrapErrorType  = reflect.TypeOf(fmt.Errorf("%w", errors.New("")))
+)
+
+// errorKinds returns the kinds of err used to group failures. The kind of an error is the
+// Go type of the outermost error of its wrap chain having a type of its own, such as
+// *fs.PathError. Chains created only by errors.New and fmt.Errorf are grouped by the
+// message of their innermost error up to its first colon or semicolon, hence sentinel
+// errors like io.ErrUnexpectedEOF form a group of their own. Joined errors, created by
+// errors.Join or fmt.Errorf with several %w verbs, have the kinds of all their errors.
+func errorKinds(err error) []string {
+	var kinds []string
+	var visit func(error)
+	visit = func(err error) {
+		for err != nil {
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				for _, e := range joined.Unwrap() {
+					visit(e)
+				}
+				return
+			}
+			if t := reflect.TypeOf(err); t != plainErrorType && t != wrapErrorType {
+				kinds = append(kinds, t.String())
+				return
+			}
+			next := errors.Unwrap(err)
+			if next == nil {
+				msg := err.Error()
+				if i := strings.IndexAny(msg, ":;"); i >= 0 {
+					msg = msg[:i]
+				}
+				kinds = append(kinds, strings.TrimSpace(msg))
+				return
+			}
+			err = next
+		}
+	}
+	visit(err)
+
+	sort.Strings(kinds)
+	return slices.Compact(kinds)
+}
+
+// errorCollector gathers failures of concurrently executed blocks.
+type errorCollector struct {
+	lock    sync.Mutex
+	limit   int
+	errs    []TaskError
+	failed  map[uint64]struct{} // blocks of errs
+	aborted bool
+}
+
+func newErrorCollector(limit int) *errorCollector {
+	return &errorCollector{limit: limit, failed: make(map[uint64]struct{})}
+}
+
+// hasFailed reports whether a failure of given block was collected; it is nil-safe.
+func (c *errorCollector) hasFailed(block uint64) bool {
+	if c == nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.failed[block]
+	return ok
+}
+
+// add records e. It returns ErrTooManyErrors once the limit of failures is reached.
+func (c *errorCollector) add(e TaskError) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.aborted {
+		return ErrTooManyErrors
+	}
+	c.errs = append(c.errs, e)
+	c.failed[e.Block] = struct{}{}
+	if c.limit > 0 && len(c.errs) >= c.limit {
+		c.aborted = true
+		return ErrTooManyErrors
+	}
+	return nil
+}
+
+// report returns the collected failures or nil if there are none.
+func (c *errorCollector) report() *ErrorReport {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.errs) == 0 {
+		return nil
+	}
+
+	r := &ErrorReport{
+		Errors:  append([]TaskError{}, c.errs...),
+		Counts:  make(map[string]int),
+		Aborted: c.aborted,
+	}
+	sort.Slice(r.Errors, func(i, j int) bool {
+		if r.Errors[i].Block != r.Errors[j].Block {
+			return r.Errors[i].Block < r.Errors[j].Block
+		}
+		return r.Errors[i].Tx < r.Errors[j].Tx
+	})
+	for _, e := range r.Errors {
+		for _, kind := range errorKinds(e.Err) {
+			r.Counts[kind]++
+		}
+	}
+	return r
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/0xsoniclabs/substate/substate"
+)
+
+type testTaskError struct{}
+
+func (testTaskError) Error() string { return "test task error" }
+
+func TestSubstateTaskPool_ExecuteContinueOnError(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := newSubstateDB(dbPath, nil, nil, nil)
+	require.NoError(t, err)
+	for block := uint64(1); block <= 5; block++ {
+		require.NoError(t, addSubstate(db, block))
+	}
+
+	var numTx int
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			numTx++
+			switch block {
+			case 2:
+				return fmt.Errorf("wrapped: %w", testTaskError{})
+			case 3, 4:
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		},
+
+		First: 1,
+		Last:  5,
+
+		Workers:         1,
+		ContinueOnError: true,
+		DB:              db,
+	}
+
+	err = stPool.Execute()
+	require.Equal(t, 5, numTx)
+
+	var report *ErrorReport
+	require.ErrorAs(t, err, &report)
+	require.False(t, report.Aborted)
+	require.Len(t, report.Errors, 3)
+	for i, block := range []uint64{2, 3, 4} {
+		require.Equal(t, block, report.Errors[i].Block)
+		require.Equal(t, testSubstate.Transaction, report.Errors[i].Tx)
+	}
+	require.Equal(t, map[string]int{"db.testTaskError": 1, "unexpected EOF": 2}, report.Counts)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestSubstateTaskPool_ErrorKinds(t *testing.T) {
+	_, pathErr := os.Open(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, pathErr)
+
+	tests := map[string]struct {
+		err  error
+		want []string
+	}{
+		"plain":          {errors.New("test error"), []string{"test error"}},
+		"detail":         {fmt.Errorf("balance mismatch: %v != %v", 1, 2), []string{"balance mismatch"}},
+		"sentinel":       {fmt.Errorf("tx 5: cannot read; %w", io.ErrUnexpectedEOF), []string{"unexpected EOF"}},
+		"typed":          {fmt.Errorf("cannot open; %w", pathErr), []string{"*fs.PathError"}},
+		"custom":         {fmt.Errorf("wrapped: %w", testTaskError{}), []string{"db.testTaskError"}},
+		"joined":         {errors.Join(io.ErrUnexpectedEOF, testTaskError{}, io.ErrUnexpectedEOF), []string{"db.testTaskError", "unexpected EOF"}},
+		"wrapped joined": {fmt.Errorf("block 3; %w", errors.Join(errors.New("test error"), pathErr)), []string{"*fs.PathError", "test error"}},
+		"multiple %w":    {fmt.Errorf("%w; %w", testTaskError{}, io.EOF), []string{"EOF", "db.testTaskError"}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.want, errorKinds(test.err))
+		})
+	}
+}
+
+func TestSubstateTaskPool_ExecuteContinueOnErrorCountsJoinedErrors(t *testing.T) {
+	c := newErrorCollector(0)
+	require.NoError(t, c.add(TaskError{Block: 1, Tx: 0, Err: errors.Join(io.ErrUnexpectedEOF, testTaskError{})}))
+	require.NoError(t, c.add(TaskError{Block: 2, Tx: 0, Err: io.ErrUnexpectedEOF}))
+
+	report := c.report()
+	require.Equal(t, map[string]int{"db.testTaskError": 1, "unexpected EOF": 2}, report.Counts)
+	require.Contains(t, report.Error(), "2 failed tasks, db.testTaskError: 1, unexpected EOF: 2")
+}
+
+func TestSubstateTaskPool_ExecuteContinueOnErrorResumesFromFailedBlock(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	require.NoError(t, err)
+
+	c := NewFileCheckpointer(filepath.Join(t.TempDir(), "checkpoint"))
+
+	var lock sync.Mutex
+	var executed []uint64
+	failAt := uint64(15)
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		BlockFunc: func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error {
+			lock.Lock()
+			defer lock.Unlock()
+			if block == failAt {
+				return errors.New("test error")
+			}
+			executed = append(executed, block)
+			return nil
+		},
+
+		First: 10,
+		Last:  20,
+
+		Workers:         2,
+		ContinueOnError: true,
+		Checkpoint:      c,
+		DB:              db,
+	}
+
+	var report *ErrorReport
+	require.ErrorAs(t, stPool.Execute(), &report)
+	require.Len(t, report.Errors, 1)
+	require.Len(t, executed, 10, "blocks after the failed one are executed")
+
+	// the checkpoint stops before the failed block
+	cp, _, err := c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, failAt-1, cp.Block)
+
+	// the failed block is executed again when resuming
+	failAt = 0
+	executed = nil
+	require.NoError(t, stPool.Execute())
+	require.ElementsMatch(t, []uint64{15, 16, 17, 18, 19, 20}, executed)
+
+	cp, _, err = c.LoadCheckpoint()
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), cp.Block)
+}
+
+func TestSubstateTaskPool_ExecuteContinueOnErrorMaxErrors(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := newSubstateDB(dbPath, nil, nil, nil)
+	require.NoError(t, err)
+	for block := uint64(1); block <= 5; block++ {
+		require.NoError(t, addSubstate(db, block))
+	}
+
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		BlockFunc: func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error {
+			return errors.New("test error")
+		},
+
+		First: 1,
+		Last:  5,
+
+		Workers:         1,
+		ContinueOnError: true,
+		MaxErrors:       2,
+		DB:              db,
+	}
+
+	err = stPool.Execute()
+
+	var report *ErrorReport
+	require.ErrorAs(t, err, &report)
+	require.True(t, report.Aborted)
+	require.Len(t, report.Errors, 2)
+	require.Equal(t, -1, report.Errors[0].Tx)
+}
+
+func TestSubstateTaskPool_ExecuteBlockWithoutCollector(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	require.NoError(t, err)
+
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			return errors.New("test error")
+		},
+
+		ContinueOnError: true,
+		DB:              db,
+	}
+
+	// errors are only collected during Execute
+	_, _, err = stPool.ExecuteBlock(testSubstate.Block)
+	require.Error(t, err)
+}
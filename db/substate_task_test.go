@@ -1,10 +1,18 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 
 	"github.com/0xsoniclabs/substate/substate"
 )
@@ -173,3 +181,284 @@ func TestSubstateTaskPool_ExecuteBlockSkipTransferTx(t *testing.T) {
 	require.Equal(t, int64(0), numTx)
 	require.Equal(t, int64(0), gas)
 }
+
+func TestSubstateTaskPool_ExecuteContextCancel(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var numBlocks atomic.Int64
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		BlockFunc: func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error {
+			if numBlocks.Add(1) == 10 {
+				cancel()
+			}
+			return nil
+		},
+
+		First: 0,
+		Last:  1_000_000,
+
+		Workers: 2,
+		DB:      db,
+	}
+
+	err = stPool.ExecuteContext(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, numBlocks.Load(), int64(1_000_000))
+}
+
+func TestSubstateTaskPool_ExecuteContextDeadline(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		BlockFunc: func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+
+		First: 0,
+		Last:  1_000_000,
+
+		Workers: 2,
+		DB:      db,
+	}
+
+	err = stPool.ExecuteContext(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSubstateTaskPool_NewSubstateTaskPool(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := TaskPoolConfig{SkipTransferTxs: true, SkipCreateTxs: true}
+	taskFunc := func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+		return nil
+	}
+	stPool := db.NewSubstateTaskPoolWithConfig("test", taskFunc, testSubstate.Block, testSubstate.Block+1, cfg)
+	require.Equal(t, WorkersFlag.Value, stPool.Workers)
+	require.True(t, stPool.SkipTransferTxs)
+	require.False(t, stPool.SkipCallTxs)
+	require.True(t, stPool.SkipCreateTxs)
+	require.Nil(t, stPool.Ctx)
+
+	// the only transaction is a transfer
+	numTx, gas, err := stPool.ExecuteBlock(testSubstate.Block)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), numTx)
+	require.Equal(t, int64(0), gas)
+}
+
+func TestSubstateTaskPool_NewSubstateTaskPoolFailsOnInvalidFlags(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := createDbAndPutSubstate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.Int(WorkersFlag.Name, 0, "")
+	set.String(FilterFlag.Name, "", "")
+	require.NoError(t, set.Parse([]string{"--workers", "7", "--filter", "nonsense"}))
+
+	stPool := db.NewSubstateTaskPool("test", nil, testSubstate.Block, testSubstate.Block+1, cli.NewContext(nil, set, nil))
+	require.ErrorContains(t, stPool.Execute(), "test: invalid configuration")
+	_, _, err = stPool.ExecuteBlock(testSubstate.Block)
+	require.ErrorContains(t, err, "test: invalid configuration")
+}
+
+func TestSubstateTaskPool_NewTaskPoolConfigFromCli(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.Int(WorkersFlag.Name, 0, "")
+	set.Bool(SkipCallTxsFlag.Name, false, "")
+	require.NoError(t, set.Parse([]string{"--workers", "7", "--skip-call-txs"}))
+
+	cfg, err := NewTaskPoolConfigFromCli(cli.NewContext(nil, set, nil))
+	require.NoError(t, err)
+	require.Equal(t, TaskPoolConfig{Workers: 7, SkipCallTxs: true}, cfg)
+}
+
+func TestSubstateTaskPool_NewTaskPoolConfigFromCliFilter(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String(FilterFlag.Name, "", "")
+	require.NoError(t, set.Parse([]string{"--filter", "create || transfer && !failed"}))
+
+	cfg, err := NewTaskPoolConfigFromCli(cli.NewContext(nil, set, nil))
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Filter)
+	require.True(t, cfg.Filter(testSubstate))
+
+	require.NoError(t, set.Set(FilterFlag.Name, "create &&"))
+	_, err = NewTaskPoolConfigFromCli(cli.NewContext(nil, set, nil))
+	require.Error(t, err)
+}
+
+func TestSubstateTaskPool_ExecuteParallelTxs(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := newSubstateDB(dbPath, nil, nil, nil)
+	require.NoError(t, err)
+
+	const numBlocks, txsPerBlock = 5, 20
+	for block := uint64(1); block <= numBlocks; block++ {
+		for tx := 0; tx < txsPerBlock; tx++ {
+			ss := *testSubstate
+			ss.Transaction = tx
+			require.NoError(t, addCustomSubstate(db, block, &ss))
+		}
+	}
+
+	var lock sync.Mutex
+	preparedBlocks := make(map[uint64]bool)
+	executed := make(map[uint64]int)
+	reporter := new(recordingProgressReporter)
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		BlockFunc: func(block uint64, transactions map[int]*substate.Substate, taskPool *SubstateTaskPool) error {
+			lock.Lock()
+			defer lock.Unlock()
+			preparedBlocks[block] = true
+			return nil
+		},
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			lock.Lock()
+			defer lock.Unlock()
+			if !preparedBlocks[block] {
+				return fmt.Errorf("transaction %v_%v executed before its block", block, tx)
+			}
+			executed[block]++
+			return nil
+		},
+
+		First: 1,
+		Last:  numBlocks,
+
+		Workers:     4,
+		ParallelTxs: true,
+		Progress:    reporter,
+		DB:          db,
+	}
+
+	require.NoError(t, stPool.Execute())
+	for block := uint64(1); block <= numBlocks; block++ {
+		require.Equal(t, txsPerBlock, executed[block])
+	}
+
+	final := reporter.finish[0]
+	require.Equal(t, int64(numBlocks), final.NumBlocks)
+	require.Equal(t, int64(numBlocks*txsPerBlock), final.NumTxs)
+	require.Equal(t, int64(numBlocks*txsPerBlock)*int64(testSubstate.Result.GasUsed), final.Gas)
+}
+
+func TestSubstateTaskPool_ExecuteParallelTxsErr(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := newSubstateDB(dbPath, nil, nil, nil)
+	require.NoError(t, err)
+
+	for tx := 0; tx < 10; tx++ {
+		ss := *testSubstate
+		ss.Transaction = tx
+		require.NoError(t, addCustomSubstate(db, 1, &ss))
+	}
+
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			if tx == 5 {
+				return errors.New("test error")
+			}
+			return nil
+		},
+
+		First: 1,
+		Last:  3,
+
+		Workers:     2,
+		ParallelTxs: true,
+		Progress:    SilentProgressReporter{},
+		DB:          db,
+	}
+
+	err = stPool.Execute()
+	require.ErrorContains(t, err, "1_5: test error")
+}
+
+func TestSubstateTaskPool_ExecuteSampler(t *testing.T) {
+	dbPath := t.TempDir() + "test-db"
+	db, err := newSubstateDB(dbPath, nil, nil, nil)
+	require.NoError(t, err)
+
+	for block := uint64(1); block <= 20; block++ {
+		require.NoError(t, addSubstate(db, block))
+	}
+
+	var lock sync.Mutex
+	var executed []uint64
+	reporter := new(recordingProgressReporter)
+	stPool := SubstateTaskPool{
+		Name: "test",
+
+		TaskFunc: func(block uint64, tx int, substate *substate.Substate, taskPool *SubstateTaskPool) error {
+			lock.Lock()
+			defer lock.Unlock()
+			executed = append(executed, block)
+			return nil
+		},
+
+		First: 1,
+		Last:  20,
+
+		Workers:  4,
+		Sampler:  EveryNthBlock(5),
+		Progress: reporter,
+		DB:       db,
+	}
+
+	require.NoError(t, stPool.Execute())
+	sort.Slice(executed, func(i, j int) bool { return executed[i] < executed[j] })
+	require.Equal(t, []uint64{5, 10, 15, 20}, executed)
+
+	require.Len(t, reporter.finish, 1)
+	finish := reporter.finish[0]
+	require.True(t, finish.Sampled)
+	require.Equal(t, int64(4), finish.NumBlocks)
+	require.Equal(t, uint64(21), finish.Watermark)
+}
+
+func TestSubstateTaskPool_NewTaskPoolConfigFromCliSample(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String(SampleFlag.Name, "", "")
+	set.Int64(SampleSeedFlag.Name, 0, "")
+	require.NoError(t, set.Parse([]string{"--sample", "every=2", "--sample-seed", "3"}))
+
+	cfg, err := NewTaskPoolConfigFromCli(cli.NewContext(nil, set, nil))
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Sampler)
+	require.True(t, cfg.Sampler(4))
+	require.False(t, cfg.Sampler(5))
+
+	require.NoError(t, set.Set(SampleFlag.Name, "every=x"))
+	_, err = NewTaskPoolConfigFromCli(cli.NewContext(nil, set, nil))
+	require.Error(t, err)
+}
@@ -56,6 +56,11 @@ func NewUpdateDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.Read
 	return newUpdateDB(path, o, wo, ro)
 }
 
+// NewUpdateDBWithEngine creates new instance of UpdateDB stored in given Engine with default options.
+func NewUpdateDBWithEngine(path string, engine Engine) (UpdateDB, error) {
+	return newUpdateDBWithEngine(path, engine, false)
+}
+
 func MakeDefaultUpdateDBFromBaseDB(db BaseDB) UpdateDB {
 	return &updateDB{&codeDB{&baseDB{backend: db.getBackend()}}}
 }
@@ -65,6 +70,11 @@ func NewReadOnlyUpdateDB(path string) (UpdateDB, error) {
 	return newUpdateDB(path, &opt.Options{ReadOnly: true}, nil, nil)
 }
 
+// NewReadOnlyUpdateDBWithEngine creates a new instance of read-only UpdateDB stored in given Engine.
+func NewReadOnlyUpdateDBWithEngine(path string, engine Engine) (UpdateDB, error) {
+	return newUpdateDBWithEngine(path, engine, true)
+}
+
 func newUpdateDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.ReadOptions) (*updateDB, error) {
 	base, err := newCodeDB(path, o, wo, ro)
 	if err != nil {
@@ -73,6 +83,14 @@ func newUpdateDB(path string, o *opt.Options, wo *opt.WriteOptions, ro *opt.Read
 	return &updateDB{base}, nil
 }
 
+func newUpdateDBWithEngine(path string, engine Engine, readOnly bool) (*updateDB, error) {
+	base, err := newCodeDBWithEngine(path, engine, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &updateDB{base}, nil
+}
+
 type updateDB struct {
 	*codeDB
 }
@@ -80,7 +98,7 @@ type updateDB struct {
 func (db *updateDB) GetFirstKey() (uint64, error) {
 	r := util.BytesPrefix([]byte(UpdateDBPrefix))
 
-	iter := db.backend.NewIterator(r, db.ro)
+	iter := db.backend.NewIterator(r)
 	defer iter.Release()
 
 	for iter.Next() {
@@ -96,7 +114,7 @@ func (db *updateDB) GetFirstKey() (uint64, error) {
 func (db *updateDB) GetLastKey() (uint64, error) {
 	r := util.BytesPrefix([]byte(UpdateDBPrefix))
 
-	iter := db.backend.NewIterator(r, nil)
+	iter := db.backend.NewIterator(r)
 	defer iter.Release()
 
 	for iter.Next() {
@@ -18,7 +18,7 @@ func newUpdateSetIterator(db *updateDB, start, end uint64) *updateSetIterator {
 	r.Start = append(r.Start, num...)
 
 	return &updateSetIterator{
-		iterator: newIterator[*updateset.UpdateSet](db.backend.NewIterator(r, db.ro)),
+		iterator: newIterator[*updateset.UpdateSet](db.backend.NewIterator(r)),
 		db:       db,
 		endBlock: end,
 	}
@@ -0,0 +1,283 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/0xsoniclabs/substate/types/hash"
+	trlp "github.com/0xsoniclabs/substate/types/rlp"
+	"github.com/0xsoniclabs/substate/updateset"
+)
+
+// Categories of issues found by VerifySubstateDB.
+const (
+	IssueInvalidKey   = "invalid key"   // key cannot be decoded
+	IssueInvalidValue = "invalid value" // value cannot be decoded
+	IssueMissingCode  = "missing code"  // referenced code or init code is not stored
+	IssueCodeHash     = "code hash"     // stored code does not hash to its key
+	IssueOrder        = "order"         // substate is stored under the key of another block
+	IssueMetadata     = "metadata"      // metadata value is invalid
+)
+
+// errStopVerification stops the verification after the first issue.
+var errStopVerification = errors.New("verification stopped")
+
+// VerifyConfig contains options of VerifySubstateDB.
+type VerifyConfig struct {
+	StopOnFirstIssue bool // stop verification at the first issue
+}
+
+// VerifyIssue is a problem of the record stored at Key.
+type VerifyIssue struct {
+	Category string
+	Key      []byte
+	Err      error
+}
+
+func (i VerifyIssue) String() string {
+	return fmt.Sprintf("%s: key %x: %v", i.Category, i.Key, i.Err)
+}
+
+// VerifyReport lists the issues found by VerifySubstateDB.
+type VerifyReport struct {
+	Records map[string]int64 // number of verified records per key prefix
+	Issues  []VerifyIssue    // issues in order of discovery
+	Counts  map[string]int   // number of issues per category
+	Stopped bool             // verification stopped at the first issue
+}
+
+// OK returns true if no issue was found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Print writes the issues grouped by category and a summary into w.
+func (r *VerifyReport) Print(w io.Writer) error {
+	categories := make([]string, 0, len(r.Counts))
+	for category := range r.Counts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	var b strings.Builder
+	for _, category := range categories {
+		fmt.Fprintf(&b, "%s (%d):\n", category, r.Counts[category])
+		for _, issue := range r.Issues {
+			if issue.Category == category {
+				fmt.Fprintf(&b, "  key %x: %v\n", issue.Key, issue.Err)
+			}
+		}
+	}
+
+	prefixes := make([]string, 0, len(r.Records))
+	for prefix := range r.Records {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	b.WriteString("verified")
+	for i, prefix := range prefixes {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, " %d %s", r.Records[prefix], prefix)
+	}
+	fmt.Fprintf(&b, " records; %d issues", len(r.Issues))
+	if r.Stopped {
+		b.WriteString(" (stopped at first issue)")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type verifier struct {
+	db     SubstateDB
+	cfg    VerifyConfig
+	report *VerifyReport
+}
+
+// VerifySubstateDB checks the integrity of every record of db stored under the substate,
+// code, update-set, destroyed-account and metadata prefixes:
+//
+//   - every key decodes with its Decode*Key function,
+//   - every value decodes, substates with the encoding of db,
+//   - every code and init code referenced by a substate or update set is stored,
+//   - every stored code hashes to its key,
+//   - every substate belongs to the block of its key.
+//
+// Issues are collected into the report; the returned error reports a failure to read db.
+func VerifySubstateDB(db SubstateDB, cfg VerifyConfig) (*VerifyReport, error) {
+	v := &verifier{
+		db:  db,
+		cfg: cfg,
+		report: &VerifyReport{
+			Records: make(map[string]int64),
+			Counts:  make(map[string]int),
+		},
+	}
+
+	steps := []struct {
+		prefix string
+		verify func(key, value []byte) error
+	}{
+		{CodeDBPrefix, v.verifyCode},
+		{SubstateDBPrefix, v.substateVerifier()},
+		{UpdateDBPrefix, v.verifyUpdateSet},
+		{DestroyedAccountPrefix, v.verifyDestroyedAccount},
+		{MetadataPrefix, v.verifyMetadata},
+	}
+	for _, step := range steps {
+		err := v.walk(step.prefix, step.verify)
+		if errors.Is(err, errStopVerification) {
+			v.report.Stopped = true
+			break
+		}
+		if err != nil {
+			return v.report, err
+		}
+	}
+	return v.report, nil
+}
+
+// walk calls verify for every record of given prefix.
+func (v *verifier) walk(prefix string, verify func(key, value []byte) error) error {
+	iter := v.db.NewIterator([]byte(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		v.report.Records[prefix]++
+		if err := verify(iter.Key(), iter.Value()); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("cannot iterate %v records; %w", prefix, err)
+	}
+	return nil
+}
+
+// issue records an issue; it returns errStopVerification if verification stops at the first issue.
+func (v *verifier) issue(category string, key []byte, err error) error {
+	v.report.Issues = append(v.report.Issues, VerifyIssue{Category: category, Key: bytes.Clone(key), Err: err})
+	v.report.Counts[category]++
+	if v.cfg.StopOnFirstIssue {
+		return errStopVerification
+	}
+	return nil
+}
+
+// checkCode records an issue unless code of given hash is stored.
+func (v *verifier) checkCode(key []byte, codeHash types.Hash) error {
+	has, err := v.db.HasCode(codeHash)
+	if err != nil {
+		return fmt.Errorf("cannot get code %s; %w", codeHash, err)
+	}
+	if !has {
+		return v.issue(IssueMissingCode, key, fmt.Errorf("code %s is not stored", codeHash))
+	}
+	return nil
+}
+
+func (v *verifier) verifyCode(key, value []byte) error {
+	codeHash, err := DecodeCodeDBKey(key)
+	if err != nil {
+		return v.issue(IssueInvalidKey, key, err)
+	}
+	if got := hash.Keccak256Hash(value); got != codeHash {
+		return v.issue(IssueCodeHash, key, fmt.Errorf("code hashes to %s", got))
+	}
+	return nil
+}
+
+func (v *verifier) substateVerifier() func(key, value []byte) error {
+	var references []types.Hash
+	encoding, encodingErr := newSubstateEncoding(v.db.GetSubstateEncoding(), func(codeHash types.Hash) ([]byte, error) {
+		references = append(references, codeHash)
+		return nil, nil
+	})
+
+	return func(key, value []byte) error {
+		block, tx, err := DecodeSubstateDBKey(key)
+		if err != nil {
+			return v.issue(IssueInvalidKey, key, err)
+		}
+		if encodingErr != nil {
+			return v.issue(IssueInvalidValue, key, encodingErr)
+		}
+		references = references[:0]
+		ss, err := encoding.decode(value, block, tx)
+		if err != nil {
+			return v.issue(IssueInvalidValue, key, err)
+		}
+		if ss.Env != nil && ss.Env.Number != block {
+			if err = v.issue(IssueOrder, key, fmt.Errorf("substate of block %v is stored at block %v", ss.Env.Number, block)); err != nil {
+				return err
+			}
+		}
+		for _, codeHash := range references {
+			if err = v.checkCode(key, codeHash); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (v *verifier) verifyUpdateSet(key, value []byte) error {
+	if _, err := DecodeUpdateSetKey(key); err != nil {
+		return v.issue(IssueInvalidKey, key, err)
+	}
+	var updateSet updateset.UpdateSetRLP
+	if err := trlp.DecodeBytes(value, &updateSet); err != nil {
+		return v.issue(IssueInvalidValue, key, err)
+	}
+	if len(updateSet.WorldState.Addresses) != len(updateSet.WorldState.Accounts) {
+		return v.issue(IssueInvalidValue, key, fmt.Errorf("%d addresses but %d accounts", len(updateSet.WorldState.Addresses), len(updateSet.WorldState.Accounts)))
+	}
+	for _, acc := range updateSet.WorldState.Accounts {
+		if err := v.checkCode(key, acc.CodeHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *verifier) verifyDestroyedAccount(key, value []byte) error {
+	if _, _, err := DecodeDestroyedAccountKey(key); err != nil {
+		return v.issue(IssueInvalidKey, key, err)
+	}
+	if _, err := DecodeAddressList(value); err != nil {
+		return v.issue(IssueInvalidValue, key, err)
+	}
+	return nil
+}
+
+// verifyMetadata checks the values of known metadata keys; other keys are skipped.
+func (v *verifier) verifyMetadata(key, value []byte) error {
+	var err error
+	switch k := string(key); {
+	case k == SubstateEncodingKey:
+		_, err = newSubstateEncoding(string(value), nil)
+	case k == UpdatesetIntervalKey, k == UpdatesetSizeKey:
+		if len(value) != 8 {
+			err = fmt.Errorf("invalid length of 64-bit value: %v", len(value))
+		}
+	case strings.HasPrefix(k, CheckpointPrefix):
+		if len(value) != checkpointLength {
+			err = fmt.Errorf("invalid length of checkpoint: %v", len(value))
+		}
+	case k == ConvertCheckpointKey:
+		if !bytes.HasPrefix(value, []byte(CodeDBPrefix)) && !bytes.HasPrefix(value, []byte(SubstateDBPrefix)) {
+			err = fmt.Errorf("invalid conversion checkpoint %x", value)
+		}
+	}
+	if err != nil {
+		return v.issue(IssueMetadata, key, err)
+	}
+	return nil
+}
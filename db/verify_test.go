@@ -0,0 +1,104 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/0xsoniclabs/substate/types/hash"
+	"github.com/stretchr/testify/require"
+)
+
+// createVerifyTestDB returns a db with substates of 3 blocks and records of every other prefix.
+func createVerifyTestDB(t *testing.T, encoding string) *substateDB {
+	db := createTestSubstateDB(t, encoding, 1, 3, 2)
+	putTestUpdateSet(t, db, 2)
+	require.NoError(t, MakeDefaultUpdateDBFromBaseDB(db).PutMetadata(1000, 10))
+	require.NoError(t, MakeDefaultDestroyedAccountDBFromBaseDB(db).SetDestroyedAccounts(2, 1, []types.Address{{4}}, nil))
+	require.NoError(t, NewDBCheckpointer(db, "test").SaveCheckpoint(Checkpoint{First: 1, Last: 3, Block: 3}))
+	return db
+}
+
+func TestVerifySubstateDB_ValidDBHasNoIssues(t *testing.T) {
+	for _, encoding := range []string{"rlp", "protobuf"} {
+		t.Run(encoding, func(t *testing.T) {
+			db := createVerifyTestDB(t, encoding)
+
+			report, err := VerifySubstateDB(db, VerifyConfig{})
+			require.NoError(t, err)
+			require.True(t, report.OK(), "unexpected issues: %v", report.Issues)
+			require.Equal(t, int64(6), report.Records[SubstateDBPrefix])
+			require.Equal(t, int64(1), report.Records[UpdateDBPrefix])
+			require.Equal(t, int64(1), report.Records[DestroyedAccountPrefix])
+			require.NotZero(t, report.Records[CodeDBPrefix])
+			require.NotZero(t, report.Records[MetadataPrefix])
+
+			var out bytes.Buffer
+			require.NoError(t, report.Print(&out))
+			require.Contains(t, out.String(), "6 1s")
+			require.Contains(t, out.String(), "; 0 issues\n")
+		})
+	}
+}
+
+func TestVerifySubstateDB_ReportsIssuesByCategory(t *testing.T) {
+	db := createVerifyTestDB(t, "rlp")
+
+	// input code of substate 2_0
+	missing := hash.Keccak256Hash([]byte{2, 0})
+	require.NoError(t, db.DeleteCode(missing))
+	// code stored under a hash of other code
+	require.NoError(t, db.Put(CodeDBKey(hash.Keccak256Hash([]byte("code"))), []byte("other code")))
+	// key of invalid length
+	require.NoError(t, db.Put([]byte(SubstateDBPrefix+"x"), []byte{}))
+	// value which is not a substate
+	require.NoError(t, db.Put(SubstateDBKey(4, 0), []byte{0x01, 0x02}))
+	// substate of block 3 stored at block 5
+	ss, err := db.GetSubstate(3, 0)
+	require.NoError(t, err)
+	ss.Block = 5
+	require.NoError(t, db.PutSubstate(ss))
+	// invalid metadata
+	require.NoError(t, db.Put([]byte(UpdatesetSizeKey), []byte{1}))
+
+	report, err := VerifySubstateDB(db, VerifyConfig{})
+	require.NoError(t, err)
+	require.False(t, report.Stopped)
+	require.Equal(t, map[string]int{
+		IssueMissingCode:  1,
+		IssueCodeHash:     1,
+		IssueInvalidKey:   1,
+		IssueInvalidValue: 1,
+		IssueOrder:        1,
+		IssueMetadata:     1,
+	}, report.Counts)
+
+	for _, issue := range report.Issues {
+		if issue.Category == IssueMissingCode {
+			require.Equal(t, SubstateDBKey(2, 0), issue.Key)
+			require.ErrorContains(t, issue.Err, missing.String())
+		}
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, report.Print(&out))
+	require.Contains(t, out.String(), "missing code (1):\n")
+	require.Contains(t, out.String(), "; 6 issues\n")
+}
+
+func TestVerifySubstateDB_StopsOnFirstIssue(t *testing.T) {
+	db := createVerifyTestDB(t, "protobuf")
+	require.NoError(t, db.Put([]byte(SubstateDBPrefix+"x"), []byte{}))
+	require.NoError(t, db.Put([]byte(SubstateDBPrefix+"y"), []byte{}))
+
+	report, err := VerifySubstateDB(db, VerifyConfig{StopOnFirstIssue: true})
+	require.NoError(t, err)
+	require.True(t, report.Stopped)
+	require.Len(t, report.Issues, 1)
+	require.Equal(t, []byte(SubstateDBPrefix+"x"), report.Issues[0].Key)
+	require.Zero(t, report.Records[MetadataPrefix], "verification must not continue with other prefixes")
+
+	var out bytes.Buffer
+	require.NoError(t, report.Print(&out))
+	require.Contains(t, out.String(), "(stopped at first issue)")
+}
@@ -30,14 +30,16 @@ func toProtobufSubstate(ss *substate.Substate) *Substate {
 }
 
 // toProtobufAlloc converts substate.WorldState into protobuf-encoded Substate_Alloc
+// sorted by address and storage key
 func toProtobufAlloc(sw substate.WorldState) *Substate_Alloc {
 	world := make([]*Substate_AllocEntry, 0, len(sw))
-	for addr, acct := range sw {
+	for _, addr := range sw.SortedAddresses() {
+		acct := sw[addr]
 		storage := make([]*Substate_Account_StorageEntry, 0, len(acct.Storage))
-		for key, value := range acct.Storage {
+		for _, key := range acct.SortedStorageKeys() {
 			storage = append(storage, &Substate_Account_StorageEntry{
 				Key:   key.Bytes(),
-				Value: value.Bytes(),
+				Value: acct.Storage[key].Bytes(),
 			})
 		}
 
@@ -57,13 +59,14 @@ func toProtobufAlloc(sw substate.WorldState) *Substate_Alloc {
 	return &Substate_Alloc{Alloc: world}
 }
 
-// encode converts substate.Env into protobuf-encoded Substate_BlockEnv
+// encode converts substate.Env into protobuf-encoded Substate_BlockEnv with block hashes sorted by number
 func toProtobufBlockEnv(se *substate.Env) *Substate_BlockEnv {
 	blockHashes := make([]*Substate_BlockEnv_BlockHashEntry, 0, len(se.BlockHashes))
-	for number, hash := range se.BlockHashes {
+	for _, number := range se.SortedBlockNumbers() {
+		number := number
 		blockHashes = append(blockHashes, &Substate_BlockEnv_BlockHashEntry{
 			Key:   &number,
-			Value: hash.Bytes(),
+			Value: se.BlockHashes[number].Bytes(),
 		})
 	}
 
@@ -82,16 +85,22 @@ func toProtobufBlockEnv(se *substate.Env) *Substate_BlockEnv {
 
 // encode converts substate.Message into protobuf-encoded Substate_TxMessage
 func toProtobufTxMessage(sm *substate.Message) *Substate_TxMessage {
-	dt := Substate_TxMessage_TXTYPE_LEGACY
+	dt := txTypeOf(sm)
 	txType := &dt
 	if sm.ProtobufTxType != nil {
 		t := Substate_TxMessage_TxType(*sm.ProtobufTxType)
 		txType = &t
 	}
 
+	// to=nil means contract creation, its init code is stored in the code db
+	var input isSubstate_TxMessage_Input = &Substate_TxMessage_Data{Data: sm.Data}
+	if sm.To == nil {
+		input = &Substate_TxMessage_InitCodeHash{InitCodeHash: hash.Keccak256Hash(sm.Data).Bytes()}
+	}
+
 	accessList := make([]*Substate_TxMessage_AccessListEntry, len(sm.AccessList))
-	for i, entry := range sm.AccessList {
-		accessList[i].toProtobufAccessListEntry(&entry)
+	for i := range sm.AccessList {
+		accessList[i] = toProtobufAccessListEntry(&sm.AccessList[i])
 	}
 
 	blobHashes := make([][]byte, len(sm.BlobHashes))
@@ -106,7 +115,7 @@ func toProtobufTxMessage(sm *substate.Message) *Substate_TxMessage {
 		From:          sm.From.Bytes(),
 		To:            AddressToWrapperspbBytes(sm.To),
 		Value:         sm.Value.Bytes(),
-		Input:         &Substate_TxMessage_Data{Data: sm.Data},
+		Input:         input,
 		TxType:        txType,
 		AccessList:    accessList,
 		GasFeeCap:     BigIntToWrapperspbBytes(sm.GasFeeCap),
@@ -116,14 +125,32 @@ func toProtobufTxMessage(sm *substate.Message) *Substate_TxMessage {
 	}
 }
 
+// txTypeOf infers the tx type of messages not decoded from protobuf, e.g. from rlp, by
+// the fields in use. Fields of later tx types which are left at their defaults are
+// decoded to the same values, hence the inferred type preserves the message. A fee or
+// tip cap without a gas price is a dynamic-fee message.
+func txTypeOf(sm *substate.Message) Substate_TxMessage_TxType {
+	switch {
+	case sm.BlobGasFeeCap != nil || len(sm.BlobHashes) > 0:
+		return Substate_TxMessage_TXTYPE_BLOB
+	case (sm.GasFeeCap != nil && (sm.GasPrice == nil || sm.GasFeeCap.Cmp(sm.GasPrice) != 0)) ||
+		(sm.GasTipCap != nil && (sm.GasPrice == nil || sm.GasTipCap.Cmp(sm.GasPrice) != 0)):
+		return Substate_TxMessage_TXTYPE_DYNAMICFEE
+	case len(sm.AccessList) > 0:
+		return Substate_TxMessage_TXTYPE_ACCESSLIST
+	default:
+		return Substate_TxMessage_TXTYPE_LEGACY
+	}
+}
+
 // toProtobufAccessListEntry converts types.AccessTuple into protobuf-encoded Substate_TxMessage_AccessListEntry
-func (entry *Substate_TxMessage_AccessListEntry) toProtobufAccessListEntry(sat *types.AccessTuple) {
+func toProtobufAccessListEntry(sat *types.AccessTuple) *Substate_TxMessage_AccessListEntry {
 	keys := make([][]byte, len(sat.StorageKeys))
 	for i, key := range sat.StorageKeys {
 		keys[i] = key.Bytes()
 	}
 
-	entry = &Substate_TxMessage_AccessListEntry{
+	return &Substate_TxMessage_AccessListEntry{
 		Address:     sat.Address.Bytes(),
 		StorageKeys: keys,
 	}
@@ -133,7 +160,7 @@ func (entry *Substate_TxMessage_AccessListEntry) toProtobufAccessListEntry(sat *
 func toProtobufResult(sr *substate.Result) *Substate_Result {
 	logs := make([]*Substate_Result_Log, len(sr.Logs))
 	for i, log := range sr.Logs {
-		logs[i].toProtobufLog(log)
+		logs[i] = toProtobufLog(log)
 	}
 
 	return &Substate_Result{
@@ -145,13 +172,13 @@ func toProtobufResult(sr *substate.Result) *Substate_Result {
 }
 
 // toProtobufLog converts types.Log into protobuf-encoded Substate_Result_log
-func (log *Substate_Result_Log) toProtobufLog(sl *types.Log) {
+func toProtobufLog(sl *types.Log) *Substate_Result_Log {
 	topics := make([][]byte, len(sl.Topics))
 	for i, topic := range sl.Topics {
 		topics[i] = topic.Bytes()
 	}
 
-	log = &Substate_Result_Log{
+	return &Substate_Result_Log{
 		Address: sl.Address.Bytes(),
 		Topics:  topics,
 		Data:    sl.Data,
@@ -0,0 +1,335 @@
+package protobuf
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/substate"
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/0xsoniclabs/substate/types/hash"
+	"github.com/syndtr/goleveldb/leveldb"
+	"google.golang.org/protobuf/proto"
+)
+
+// substateGenerator creates random substates which are valid for given tx type.
+type substateGenerator struct {
+	rand  *rand.Rand
+	codes map[types.Hash][]byte
+}
+
+func newSubstateGenerator(seed int64) *substateGenerator {
+	return &substateGenerator{
+		rand:  rand.New(rand.NewSource(seed)),
+		codes: make(map[types.Hash][]byte),
+	}
+}
+
+func (g *substateGenerator) lookup(codeHash types.Hash) ([]byte, error) {
+	code, ok := g.codes[codeHash]
+	if !ok {
+		return nil, leveldb.ErrNotFound
+	}
+	return code, nil
+}
+
+func (g *substateGenerator) bytes(maxLen int) []byte {
+	b := make([]byte, g.rand.Intn(maxLen+1))
+	g.rand.Read(b)
+	return b
+}
+
+func (g *substateGenerator) code() []byte {
+	code := g.bytes(64)
+	g.codes[hash.Keccak256Hash(code)] = code
+	return code
+}
+
+func (g *substateGenerator) address() types.Address {
+	return types.BytesToAddress(g.bytes(types.AddressLength))
+}
+
+func (g *substateGenerator) hash() types.Hash {
+	return types.BytesToHash(g.bytes(len(types.Hash{})))
+}
+
+func (g *substateGenerator) bigInt() *big.Int {
+	return new(big.Int).SetBytes(g.bytes(32))
+}
+
+func (g *substateGenerator) worldState() substate.WorldState {
+	ws := substate.NewWorldState()
+	for i := g.rand.Intn(4); i > 0; i-- {
+		acc := substate.NewAccount(g.rand.Uint64(), g.bigInt(), g.code())
+		for j := g.rand.Intn(4); j > 0; j-- {
+			acc.Storage[g.hash()] = g.hash()
+		}
+		ws[g.address()] = acc
+	}
+	return ws
+}
+
+func (g *substateGenerator) env(txType Substate_TxMessage_TxType) *substate.Env {
+	env := &substate.Env{
+		Coinbase:    g.address(),
+		Difficulty:  g.bigInt(),
+		GasLimit:    g.rand.Uint64(),
+		Number:      g.rand.Uint64(),
+		Timestamp:   g.rand.Uint64(),
+		BlockHashes: make(map[uint64]types.Hash),
+	}
+	for i := g.rand.Intn(3); i > 0; i-- {
+		env.BlockHashes[g.rand.Uint64()] = g.hash()
+	}
+	if txType >= Substate_TxMessage_TXTYPE_DYNAMICFEE {
+		env.BaseFee = g.bigInt()
+		random := g.hash()
+		env.Random = &random
+	}
+	if txType == Substate_TxMessage_TXTYPE_BLOB {
+		env.BlobBaseFee = g.bigInt()
+	}
+	return env
+}
+
+func (g *substateGenerator) message(txType Substate_TxMessage_TxType, create bool) *substate.Message {
+	pbTxType := int32(txType)
+	msg := &substate.Message{
+		Nonce:          g.rand.Uint64(),
+		CheckNonce:     true,
+		GasPrice:       g.bigInt(),
+		Gas:            g.rand.Uint64(),
+		From:           g.address(),
+		Value:          g.bigInt(),
+		Data:           g.bytes(64),
+		ProtobufTxType: &pbTxType,
+		AccessList:     types.AccessList{},
+	}
+	if create {
+		g.codes[hash.Keccak256Hash(msg.Data)] = msg.Data
+	} else {
+		to := g.address()
+		msg.To = &to
+	}
+
+	if txType >= Substate_TxMessage_TXTYPE_ACCESSLIST {
+		for i := g.rand.Intn(4); i > 0; i-- {
+			tuple := types.AccessTuple{Address: g.address(), StorageKeys: []types.Hash{}}
+			for j := g.rand.Intn(4); j > 0; j-- {
+				tuple.StorageKeys = append(tuple.StorageKeys, g.hash())
+			}
+			msg.AccessList = append(msg.AccessList, tuple)
+		}
+	}
+
+	msg.GasFeeCap, msg.GasTipCap = msg.GasPrice, msg.GasPrice
+	if txType >= Substate_TxMessage_TXTYPE_DYNAMICFEE {
+		msg.GasFeeCap, msg.GasTipCap = g.bigInt(), g.bigInt()
+	}
+
+	if txType == Substate_TxMessage_TXTYPE_BLOB {
+		msg.BlobGasFeeCap = g.bigInt()
+		for i := g.rand.Intn(4); i > 0; i-- {
+			msg.BlobHashes = append(msg.BlobHashes, g.hash())
+		}
+	}
+	return msg
+}
+
+func (g *substateGenerator) result(msg *substate.Message) *substate.Result {
+	res := &substate.Result{
+		Status:  g.rand.Uint64() % 2,
+		Bloom:   types.BytesToBloom(g.bytes(types.BloomByteLength)),
+		Logs:    []*types.Log{},
+		GasUsed: g.rand.Uint64(),
+	}
+	if msg.To == nil {
+		res.ContractAddress = createAddress(msg.From, msg.Nonce)
+	}
+	for i := g.rand.Intn(4); i > 0; i-- {
+		log := &types.Log{Address: g.address(), Topics: []types.Hash{}, Data: g.bytes(64)}
+		for j := g.rand.Intn(5); j > 0; j-- {
+			log.Topics = append(log.Topics, g.hash())
+		}
+		res.Logs = append(res.Logs, log)
+	}
+	return res
+}
+
+func (g *substateGenerator) substate(txType Substate_TxMessage_TxType, create bool) *substate.Substate {
+	msg := g.message(txType, create)
+	return &substate.Substate{
+		InputSubstate:  g.worldState(),
+		OutputSubstate: g.worldState(),
+		Env:            g.env(txType),
+		Message:        msg,
+		Result:         g.result(msg),
+		Block:          g.rand.Uint64(),
+		Transaction:    g.rand.Intn(1000),
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	txTypes := []Substate_TxMessage_TxType{
+		Substate_TxMessage_TXTYPE_LEGACY,
+		Substate_TxMessage_TXTYPE_ACCESSLIST,
+		Substate_TxMessage_TXTYPE_DYNAMICFEE,
+		Substate_TxMessage_TXTYPE_BLOB,
+	}
+
+	for _, txType := range txTypes {
+		for _, create := range []bool{false, true} {
+			name := txType.String()
+			if create {
+				name += "_CREATE"
+			}
+			t.Run(name, func(t *testing.T) {
+				g := newSubstateGenerator(int64(txType))
+				for i := 0; i < 100; i++ {
+					want := g.substate(txType, create)
+
+					encoded, err := Encode(want, want.Block, want.Transaction)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					pbSubstate := &Substate{}
+					if err = proto.Unmarshal(encoded, pbSubstate); err != nil {
+						t.Fatal(err)
+					}
+					got, err := pbSubstate.Decode(g.lookup, want.Block, want.Transaction)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if err = want.Equal(got); err != nil {
+						t.Fatalf("substate %d differs after round trip; %v", i, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestEncode_AccessListAndLogs(t *testing.T) {
+	g := newSubstateGenerator(1)
+	ss := g.substate(Substate_TxMessage_TXTYPE_DYNAMICFEE, false)
+	ss.Message.AccessList = types.AccessList{{Address: types.Address{1}, StorageKeys: []types.Hash{{2}, {3}}}}
+	ss.Result.Logs = []*types.Log{{Address: types.Address{4}, Topics: []types.Hash{{5}}, Data: []byte{6}}}
+
+	pbSubstate := toProtobufSubstate(ss)
+
+	accessList := pbSubstate.GetTxMessage().GetAccessList()
+	if len(accessList) != 1 {
+		t.Fatalf("unexpected number of access list entries; got %d, want 1", len(accessList))
+	}
+	if got, want := types.BytesToAddress(accessList[0].GetAddress()), (types.Address{1}); got != want {
+		t.Fatalf("unexpected access list address\ngot: %v\nwant: %v", got, want)
+	}
+	if got := len(accessList[0].GetStorageKeys()); got != 2 {
+		t.Fatalf("unexpected number of storage keys; got %d, want 2", got)
+	}
+
+	logs := pbSubstate.GetResult().GetLogs()
+	if len(logs) != 1 {
+		t.Fatalf("unexpected number of logs; got %d, want 1", len(logs))
+	}
+	if got, want := types.BytesToAddress(logs[0].GetAddress()), (types.Address{4}); got != want {
+		t.Fatalf("unexpected log address\ngot: %v\nwant: %v", got, want)
+	}
+	if got := len(logs[0].GetTopics()); got != 1 {
+		t.Fatalf("unexpected number of topics; got %d, want 1", got)
+	}
+}
+
+func TestEncode_InfersTxTypeOfMessagesWithoutProtobufTxType(t *testing.T) {
+	txTypes := []Substate_TxMessage_TxType{
+		Substate_TxMessage_TXTYPE_LEGACY,
+		Substate_TxMessage_TXTYPE_ACCESSLIST,
+		Substate_TxMessage_TXTYPE_DYNAMICFEE,
+		Substate_TxMessage_TXTYPE_BLOB,
+	}
+
+	for _, txType := range txTypes {
+		g := newSubstateGenerator(int64(txType))
+		for i := 0; i < 100; i++ {
+			want := g.substate(txType, false)
+			want.Message.ProtobufTxType = nil
+
+			pbSubstate := toProtobufSubstate(want)
+			got, err := pbSubstate.Decode(g.lookup, want.Block, want.Transaction)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = want.Equal(got); err != nil {
+				t.Fatalf("%v substate %d differs after round trip; %v", txType, i, err)
+			}
+		}
+	}
+}
+
+func TestEncode_InfersDynamicFeeTxTypeWithoutGasPrice(t *testing.T) {
+	g := newSubstateGenerator(1)
+	for _, field := range []string{"GasFeeCap", "GasTipCap"} {
+		msg := g.message(Substate_TxMessage_TXTYPE_LEGACY, false)
+		msg.GasPrice, msg.GasFeeCap, msg.GasTipCap = nil, nil, nil
+		if field == "GasFeeCap" {
+			msg.GasFeeCap = big.NewInt(5)
+		} else {
+			msg.GasTipCap = big.NewInt(5)
+		}
+
+		if got := txTypeOf(msg); got != Substate_TxMessage_TXTYPE_DYNAMICFEE {
+			t.Fatalf("unexpected tx type of message with %v and without gas price; got %v", field, got)
+		}
+	}
+}
+
+func TestEncode_IsCanonical(t *testing.T) {
+	g := newSubstateGenerator(1)
+	ss := g.substate(Substate_TxMessage_TXTYPE_BLOB, false)
+	for i := 0; i < 50; i++ {
+		acc := substate.NewAccount(uint64(i), big.NewInt(int64(i)), nil)
+		for j := 0; j < 10; j++ {
+			acc.Storage[g.hash()] = g.hash()
+		}
+		ss.InputSubstate[g.address()] = acc
+		ss.Env.BlockHashes[g.rand.Uint64()] = g.hash()
+	}
+
+	want, err := Encode(ss, ss.Block, ss.Transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		// copies of the maps are iterated in different order
+		cp := *ss
+		cp.InputSubstate = make(substate.WorldState)
+		for addr, acc := range ss.InputSubstate {
+			cp.InputSubstate[addr] = acc.Copy()
+		}
+
+		got, err := Encode(&cp, ss.Block, ss.Transaction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatal("substate is encoded into different bytes")
+		}
+	}
+
+	pbSubstate := toProtobufSubstate(ss)
+	alloc := pbSubstate.GetInputAlloc().GetAlloc()
+	for i := 1; i < len(alloc); i++ {
+		if bytes.Compare(alloc[i-1].GetAddress(), alloc[i].GetAddress()) >= 0 {
+			t.Fatalf("accounts are not sorted by address at %v", i)
+		}
+	}
+	blockHashes := pbSubstate.GetBlockEnv().GetBlockHashes()
+	for i := 1; i < len(blockHashes); i++ {
+		if blockHashes[i-1].GetKey() >= blockHashes[i].GetKey() {
+			t.Fatalf("block hashes are not sorted by number at %v", i)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package rlp
 
 import (
 	"math/big"
+	"sort"
 
 	"github.com/0xsoniclabs/substate/substate"
 	"github.com/0xsoniclabs/substate/types"
@@ -62,6 +63,10 @@ func createBlockHashes(m map[uint64]types.Hash) (blockHashes [][2]types.Hash) {
 		sortedNum64 = append(sortedNum64, num64)
 	}
 
+	sort.Slice(sortedNum64, func(i, j int) bool {
+		return sortedNum64[i] < sortedNum64[j]
+	})
+
 	for _, num64 := range sortedNum64 {
 		num := types.BigToHash(new(big.Int).SetUint64(num64))
 		blockHash := m[num64]
@@ -2,7 +2,6 @@ package rlp
 
 import (
 	"math/big"
-	"sort"
 
 	"github.com/0xsoniclabs/substate/substate"
 	"github.com/0xsoniclabs/substate/types"
@@ -16,16 +15,7 @@ func NewRLPAccount(acc *substate.Account) *SubstateAccountRLP {
 		Storage:  [][2]types.Hash{},
 	}
 
-	var sortedKeys []types.Hash
-	for key := range acc.Storage {
-		sortedKeys = append(sortedKeys, key)
-	}
-
-	sort.Slice(sortedKeys, func(i, j int) bool {
-		return sortedKeys[i].Compare(sortedKeys[j]) < 0
-	})
-
-	for _, key := range sortedKeys {
+	for _, key := range acc.SortedStorageKeys() {
 		value := acc.Storage[key]
 		a.Storage = append(a.Storage, [2]types.Hash{key, value})
 	}
@@ -5,6 +5,7 @@ import (
 	"math/big"
 	"testing"
 
+	"github.com/0xsoniclabs/substate/substate"
 	"github.com/0xsoniclabs/substate/types"
 	"github.com/0xsoniclabs/substate/types/rlp"
 )
@@ -146,3 +147,52 @@ func Test_Message_ToSubstate_CorrectlyAssignsDataIfContractCreation(t *testing.T
 		t.Fatalf("unexpected data\ngot: %v\n want: %v", wantedData, m.Data)
 	}
 }
+
+func Test_NewWorldState_IsCanonical(t *testing.T) {
+	worldState := substate.NewWorldState()
+	for i := 0; i < 100; i++ {
+		acc := substate.NewAccount(uint64(i), big.NewInt(int64(i)), []byte{byte(i)})
+		for j := 0; j < 10; j++ {
+			acc.Storage[types.Hash{byte(j * i)}] = types.Hash{byte(j)}
+		}
+		worldState[types.Address{byte(i * 7)}] = acc
+	}
+
+	want, err := rlp.EncodeToBytes(NewWorldState(worldState))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := rlp.EncodeToBytes(NewWorldState(worldState))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatal("world state is encoded into different bytes")
+		}
+	}
+
+	ws := NewWorldState(worldState)
+	for i := 1; i < len(ws.Addresses); i++ {
+		if ws.Addresses[i-1].Compare(ws.Addresses[i]) >= 0 {
+			t.Fatalf("addresses are not sorted: %v >= %v", ws.Addresses[i-1], ws.Addresses[i])
+		}
+	}
+}
+
+func Test_CreateBlockHashes_IsSortedByNumber(t *testing.T) {
+	blockHashes := make(map[uint64]types.Hash)
+	for i := uint64(0); i < 100; i++ {
+		blockHashes[i*31%100] = types.Hash{byte(i)}
+	}
+
+	pairs := createBlockHashes(blockHashes)
+	if len(pairs) != len(blockHashes) {
+		t.Fatalf("unexpected number of block hashes\ngot: %v\nwant: %v", len(pairs), len(blockHashes))
+	}
+	for i, pair := range pairs {
+		if got := pair[0].Uint64(); got != uint64(i) {
+			t.Fatalf("unexpected block number at %v; got %v", i, got)
+		}
+	}
+}
@@ -8,15 +8,17 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
+// NewWorldState converts worldState into its RLP representation. Accounts are sorted
+// by address, hence equal world states are always encoded into equal bytes.
 func NewWorldState(worldState substate.WorldState) WorldState {
 	ws := WorldState{
 		Addresses: []types.Address{},
 		Accounts:  []*SubstateAccountRLP{},
 	}
 
-	for addr, acc := range worldState {
+	for _, addr := range worldState.SortedAddresses() {
 		ws.Addresses = append(ws.Addresses, addr)
-		ws.Accounts = append(ws.Accounts, NewRLPAccount(acc))
+		ws.Accounts = append(ws.Accounts, NewRLPAccount(worldState[addr]))
 	}
 
 	return ws
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/0xsoniclabs/substate/types"
@@ -68,6 +69,19 @@ func (a *Account) Copy() *Account {
 	return accCopy
 }
 
+// SortedStorageKeys returns the storage keys of a in ascending order.
+func (a *Account) SortedStorageKeys() []types.Hash {
+	keys := make([]types.Hash, 0, len(a.Storage))
+	for key := range a.Storage {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Compare(keys[j]) < 0
+	})
+	return keys
+}
+
 // CodeHash returns hashed code
 func (a *Account) CodeHash() types.Hash {
 	return hash.Keccak256Hash(a.Code)
@@ -99,3 +99,20 @@ func TestAccount_Copy(t *testing.T) {
 		t.Fatalf("accounts values must be equal\ngot: %v\nwant: %v", cpy, acc)
 	}
 }
+
+func TestAccount_SortedStorageKeys(t *testing.T) {
+	acc := NewAccount(1, new(big.Int).SetUint64(1), []byte{1})
+	for i := 100; i > 0; i-- {
+		acc.Storage[types.Hash{byte(i % 7), byte(i)}] = types.Hash{byte(i)}
+	}
+
+	keys := acc.SortedStorageKeys()
+	if len(keys) != len(acc.Storage) {
+		t.Fatalf("incorrect number of keys\n got: %v\n want: %v", len(keys), len(acc.Storage))
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1].Compare(keys[i]) >= 0 {
+			t.Fatalf("keys are not sorted: %v >= %v", keys[i-1], keys[i])
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package substate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/0xsoniclabs/substate/types"
+)
+
+// maxDiffBytes is the number of bytes of byte slices shown in a diff; longer slices are shortened.
+const maxDiffBytes = 32
+
+// SubstateDiff lists the differences between an expected (want) and an actual (got) substate.
+// It is marshalled to JSON as a machine-readable report, String renders it for humans.
+type SubstateDiff struct {
+	InputSubstate  []AccountDiff `json:"inputSubstate,omitempty"`
+	OutputSubstate []AccountDiff `json:"outputSubstate,omitempty"`
+	Env            []FieldDiff   `json:"env,omitempty"`
+	Message        []FieldDiff   `json:"message,omitempty"`
+	Result         []FieldDiff   `json:"result,omitempty"`
+	Logs           []LogDiff     `json:"logs,omitempty"`
+}
+
+// FieldDiff is a field of differing value; values are rendered as strings.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Got   string `json:"got"`
+}
+
+// Account states of AccountDiff.
+const (
+	AccountChanged    = "changed"    // the account differs
+	AccountMissing    = "missing"    // the account is expected but missing
+	AccountUnexpected = "unexpected" // the account is present but not expected
+)
+
+// AccountDiff lists the differences of an account. Fields and Storage are only set for changed accounts.
+type AccountDiff struct {
+	Address types.Address `json:"address"`
+	Status  string        `json:"status"`
+	Fields  []FieldDiff   `json:"fields,omitempty"`
+	Storage []StorageDiff `json:"storage,omitempty"`
+}
+
+// StorageDiff is a storage slot of differing value; a nil value means the slot is missing.
+type StorageDiff struct {
+	Key  types.Hash  `json:"key"`
+	Want *types.Hash `json:"want"`
+	Got  *types.Hash `json:"got"`
+}
+
+// LogDiff lists the differences of the log at Index.
+type LogDiff struct {
+	Index  int         `json:"index"`
+	Fields []FieldDiff `json:"fields"`
+}
+
+// Diff returns the differences between s (want) and y (got). Block and transaction
+// numbers are not compared; a nil substate is compared as a substate of nil components.
+func (s *Substate) Diff(y *Substate) *SubstateDiff {
+	if s == nil {
+		s = &Substate{}
+	}
+	if y == nil {
+		y = &Substate{}
+	}
+
+	return &SubstateDiff{
+		InputSubstate:  s.InputSubstate.AccountDiffs(y.InputSubstate),
+		OutputSubstate: s.OutputSubstate.AccountDiffs(y.OutputSubstate),
+		Env:            s.Env.FieldDiffs(y.Env),
+		Message:        s.Message.FieldDiffs(y.Message),
+		Result:         s.Result.FieldDiffs(y.Result),
+		Logs:           s.Result.LogDiffs(y.Result),
+	}
+}
+
+// Empty returns true if d lists no difference.
+func (d *SubstateDiff) Empty() bool {
+	return len(d.InputSubstate) == 0 && len(d.OutputSubstate) == 0 && len(d.Env) == 0 &&
+		len(d.Message) == 0 && len(d.Result) == 0 && len(d.Logs) == 0
+}
+
+// String renders the differences only, one per line, grouped by component.
+func (d *SubstateDiff) String() string {
+	var builder strings.Builder
+	writeAccountDiffs(&builder, "input substate", d.InputSubstate)
+	writeAccountDiffs(&builder, "output substate", d.OutputSubstate)
+	writeFieldDiffs(&builder, "env", d.Env)
+	writeFieldDiffs(&builder, "message", d.Message)
+	writeFieldDiffs(&builder, "result", d.Result)
+	if len(d.Logs) > 0 {
+		builder.WriteString("logs:\n")
+		for _, log := range d.Logs {
+			for _, field := range log.Fields {
+				builder.WriteString(fmt.Sprintf("  %v %v: want %v, got %v\n", log.Index, field.Field, field.Want, field.Got))
+			}
+		}
+	}
+	return builder.String()
+}
+
+func writeAccountDiffs(builder *strings.Builder, title string, diffs []AccountDiff) {
+	if len(diffs) == 0 {
+		return
+	}
+	builder.WriteString(title + ":\n")
+	for _, diff := range diffs {
+		if diff.Status != AccountChanged {
+			builder.WriteString(fmt.Sprintf("  %s: %v\n", diff.Address, diff.Status))
+			continue
+		}
+		for _, field := range diff.Fields {
+			builder.WriteString(fmt.Sprintf("  %s %v: want %v, got %v\n", diff.Address, field.Field, field.Want, field.Got))
+		}
+		for _, slot := range diff.Storage {
+			builder.WriteString(fmt.Sprintf("  %s storage %s: want %v, got %v\n", diff.Address, slot.Key, formatSlot(slot.Want), formatSlot(slot.Got)))
+		}
+	}
+}
+
+func writeFieldDiffs(builder *strings.Builder, title string, diffs []FieldDiff) {
+	if len(diffs) == 0 {
+		return
+	}
+	builder.WriteString(title + ":\n")
+	for _, field := range diffs {
+		builder.WriteString(fmt.Sprintf("  %v: want %v, got %v\n", field.Field, field.Want, field.Got))
+	}
+}
+
+// AccountDiffs returns the differences between ws (want) and y (got) sorted by address.
+// A nil account is treated like a missing one.
+func (ws WorldState) AccountDiffs(y WorldState) []AccountDiff {
+	addresses := ws.SortedAddresses()
+	for addr := range y {
+		if _, found := ws[addr]; !found {
+			addresses = append(addresses, addr)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Compare(addresses[j]) < 0
+	})
+
+	var diffs []AccountDiff
+	for _, addr := range addresses {
+		want, got := ws[addr], y[addr]
+		inWant, inGot := want != nil, got != nil
+		switch {
+		case !inWant && !inGot:
+			continue
+		case !inGot:
+			diffs = append(diffs, AccountDiff{Address: addr, Status: AccountMissing})
+		case !inWant:
+			diffs = append(diffs, AccountDiff{Address: addr, Status: AccountUnexpected})
+		case !want.Equal(got):
+			diffs = append(diffs, AccountDiff{
+				Address: addr,
+				Status:  AccountChanged,
+				Fields:  want.FieldDiffs(got),
+				Storage: want.StorageDiffs(got),
+			})
+		}
+	}
+	return diffs
+}
+
+// FieldDiffs returns the differences of nonce, balance and code between a (want) and y (got).
+func (a *Account) FieldDiffs(y *Account) []FieldDiff {
+	if a == nil || y == nil {
+		return nilDiffs("Account", a == nil, y == nil)
+	}
+
+	var diffs fieldDiffs
+	diffs.uint64("Nonce", a.Nonce, y.Nonce)
+	diffs.bigInt("Balance", a.Balance, y.Balance)
+	if !bytes.Equal(a.Code, y.Code) {
+		diffs.add("Code", formatCode(a), formatCode(y))
+	}
+	return diffs
+}
+
+// StorageDiffs returns the differing storage slots of a (want) and y (got) sorted by key.
+// A nil account has no storage.
+func (a *Account) StorageDiffs(y *Account) []StorageDiff {
+	if a == nil {
+		a = &Account{}
+	}
+	if y == nil {
+		y = &Account{}
+	}
+	keys := a.SortedStorageKeys()
+	for key := range y.Storage {
+		if _, found := a.Storage[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Compare(keys[j]) < 0
+	})
+
+	var diffs []StorageDiff
+	for _, key := range keys {
+		want, inWant := a.Storage[key]
+		got, inGot := y.Storage[key]
+		if inWant && inGot && want == got {
+			continue
+		}
+		diff := StorageDiff{Key: key}
+		if inWant {
+			diff.Want = &want
+		}
+		if inGot {
+			diff.Got = &got
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// FieldDiffs returns the differing fields of e (want) and y (got).
+func (e *Env) FieldDiffs(y *Env) []FieldDiff {
+	if e == nil || y == nil {
+		return nilDiffs("Env", e == nil, y == nil)
+	}
+
+	var diffs fieldDiffs
+	diffs.compare("Coinbase", e.Coinbase, y.Coinbase)
+	diffs.bigInt("Difficulty", e.Difficulty, y.Difficulty)
+	diffs.uint64("GasLimit", e.GasLimit, y.GasLimit)
+	diffs.uint64("Number", e.Number, y.Number)
+	diffs.uint64("Timestamp", e.Timestamp, y.Timestamp)
+	for _, number := range mergeBlockNumbers(e.BlockHashes, y.BlockHashes) {
+		want, inWant := e.BlockHashes[number]
+		got, inGot := y.BlockHashes[number]
+		if inWant && inGot && want == got {
+			continue
+		}
+		diffs.add(fmt.Sprintf("BlockHashes[%v]", number), formatOptional(inWant, want), formatOptional(inGot, got))
+	}
+	diffs.bigInt("BaseFee", e.BaseFee, y.BaseFee)
+	diffs.bigInt("BlobBaseFee", e.BlobBaseFee, y.BlobBaseFee)
+	diffs.hashPointer("Random", e.Random, y.Random)
+	return diffs
+}
+
+// FieldDiffs returns the differing fields of m (want) and y (got).
+func (m *Message) FieldDiffs(y *Message) []FieldDiff {
+	if m == nil || y == nil {
+		return nilDiffs("Message", m == nil, y == nil)
+	}
+
+	var diffs fieldDiffs
+	diffs.uint64("Nonce", m.Nonce, y.Nonce)
+	diffs.compare("CheckNonce", m.CheckNonce, y.CheckNonce)
+	diffs.bigInt("GasPrice", m.GasPrice, y.GasPrice)
+	diffs.uint64("Gas", m.Gas, y.Gas)
+	diffs.compare("From", m.From, y.From)
+	if !(m.To == y.To || (m.To != nil && y.To != nil && *m.To == *y.To)) {
+		diffs.add("To", formatOptional(m.To != nil, m.To), formatOptional(y.To != nil, y.To))
+	}
+	diffs.bigInt("Value", m.Value, y.Value)
+	diffs.bytes("Data", m.Data, y.Data)
+	diffs.compare("AccessList", fmt.Sprint(m.AccessList), fmt.Sprint(y.AccessList))
+	diffs.bigInt("GasFeeCap", m.GasFeeCap, y.GasFeeCap)
+	diffs.bigInt("GasTipCap", m.GasTipCap, y.GasTipCap)
+	diffs.bigInt("BlobGasFeeCap", m.BlobGasFeeCap, y.BlobGasFeeCap)
+	diffs.compare("BlobHashes", fmt.Sprint(m.BlobHashes), fmt.Sprint(y.BlobHashes))
+	return diffs
+}
+
+// FieldDiffs returns the differing fields of r (want) and y (got) except for logs, see LogDiffs.
+func (r *Result) FieldDiffs(y *Result) []FieldDiff {
+	if r == nil || y == nil {
+		return nilDiffs("Result", r == nil, y == nil)
+	}
+
+	var diffs fieldDiffs
+	diffs.uint64("Status", r.Status, y.Status)
+	diffs.bytes("Bloom", r.Bloom[:], y.Bloom[:])
+	diffs.compare("Logs", fmt.Sprintf("%v logs", len(r.Logs)), fmt.Sprintf("%v logs", len(y.Logs)))
+	diffs.compare("ContractAddress", r.ContractAddress, y.ContractAddress)
+	diffs.uint64("GasUsed", r.GasUsed, y.GasUsed)
+	return diffs
+}
+
+// LogDiffs returns the differing logs of r (want) and y (got) at same index. Logs
+// missing in either result are reported by FieldDiffs as differing number of logs.
+func (r *Result) LogDiffs(y *Result) []LogDiff {
+	if r == nil || y == nil {
+		return nil
+	}
+
+	var diffs []LogDiff
+	for i := 0; i < len(r.Logs) && i < len(y.Logs); i++ {
+		want, got := r.Logs[i], y.Logs[i]
+		var fields fieldDiffs
+		fields.compare("Address", want.Address, got.Address)
+		fields.compare("Topics", fmt.Sprint(want.Topics), fmt.Sprint(got.Topics))
+		fields.bytes("Data", want.Data, got.Data)
+		if len(fields) > 0 {
+			diffs = append(diffs, LogDiff{Index: i, Fields: fields})
+		}
+	}
+	return diffs
+}
+
+// fieldDiffs collects differing fields.
+type fieldDiffs []FieldDiff
+
+func (d *fieldDiffs) add(field, want, got string) {
+	*d = append(*d, FieldDiff{Field: field, Want: want, Got: got})
+}
+
+func (d *fieldDiffs) compare(field string, want, got any) {
+	if want != got {
+		d.add(field, fmt.Sprint(want), fmt.Sprint(got))
+	}
+}
+
+func (d *fieldDiffs) uint64(field string, want, got uint64) {
+	d.compare(field, want, got)
+}
+
+func (d *fieldDiffs) bigInt(field string, want, got *big.Int) {
+	if want == nil || got == nil {
+		if want != got {
+			d.add(field, want.String(), got.String())
+		}
+		return
+	}
+	if want.Cmp(got) != 0 {
+		d.add(field, want.String(), got.String())
+	}
+}
+
+func (d *fieldDiffs) bytes(field string, want, got []byte) {
+	if !bytes.Equal(want, got) {
+		d.add(field, formatBytes(want), formatBytes(got))
+	}
+}
+
+func (d *fieldDiffs) hashPointer(field string, want, got *types.Hash) {
+	if !(want == got || (want != nil && got != nil && *want == *got)) {
+		d.add(field, formatSlot(want), formatSlot(got))
+	}
+}
+
+func nilDiffs(field string, wantNil, gotNil bool) []FieldDiff {
+	if wantNil == gotNil {
+		return nil
+	}
+	return []FieldDiff{{Field: field, Want: presence(!wantNil), Got: presence(!gotNil)}}
+}
+
+func mergeBlockNumbers(x, y map[uint64]types.Hash) []uint64 {
+	numbers := make([]uint64, 0, len(x))
+	for number := range x {
+		numbers = append(numbers, number)
+	}
+	for number := range y {
+		if _, found := x[number]; !found {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		return numbers[i] < numbers[j]
+	})
+	return numbers
+}
+
+func presence(present bool) string {
+	if present {
+		return "present"
+	}
+	return "<nil>"
+}
+
+func formatOptional[T any](present bool, value T) string {
+	if !present {
+		return "<missing>"
+	}
+	return fmt.Sprint(value)
+}
+
+func formatSlot(value *types.Hash) string {
+	if value == nil {
+		return "<missing>"
+	}
+	return value.String()
+}
+
+// formatBytes renders b in hex, shortened to maxDiffBytes.
+func formatBytes(b []byte) string {
+	if len(b) <= maxDiffBytes {
+		return "0x" + hex.EncodeToString(b)
+	}
+	return fmt.Sprintf("0x%s... (%v bytes)", hex.EncodeToString(b[:maxDiffBytes]), len(b))
+}
+
+// formatCode renders the size and hash of code of a instead of the code itself.
+func formatCode(a *Account) string {
+	return fmt.Sprintf("%v bytes, hash %s", len(a.Code), a.CodeHash())
+}
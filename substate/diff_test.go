@@ -0,0 +1,161 @@
+package substate
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/types"
+)
+
+func TestDiff_EqualSubstatesHaveEmptyDiff(t *testing.T) {
+	diff := newFingerprintTestSubstate().Diff(newFingerprintTestSubstate())
+	if !diff.Empty() {
+		t.Fatalf("unexpected diff\n%v", diff)
+	}
+	if got := diff.String(); got != "" {
+		t.Fatalf("unexpected rendering of empty diff: %q", got)
+	}
+}
+
+func TestDiff_ReportsAccountDifferences(t *testing.T) {
+	want := newFingerprintTestSubstate()
+	got := newFingerprintTestSubstate()
+	got.InputSubstate[types.Address{1}].Nonce = 100
+	got.InputSubstate[types.Address{2}].Storage[types.Hash{2, 1}] = types.Hash{7}
+	delete(got.InputSubstate[types.Address{2}].Storage, types.Hash{2, 2})
+	delete(got.InputSubstate, types.Address{3})
+	got.InputSubstate[types.Address{0xff}] = NewAccount(1, big.NewInt(1), nil)
+
+	diff := want.Diff(got)
+	if len(diff.InputSubstate) != 4 || len(diff.OutputSubstate) != 0 {
+		t.Fatalf("unexpected number of account diffs\n%v", diff)
+	}
+
+	nonce := diff.InputSubstate[0]
+	if nonce.Address != (types.Address{1}) || nonce.Status != AccountChanged || len(nonce.Fields) != 1 ||
+		nonce.Fields[0] != (FieldDiff{Field: "Nonce", Want: "1", Got: "100"}) {
+		t.Fatalf("unexpected nonce diff: %+v", nonce)
+	}
+
+	storage := diff.InputSubstate[1].Storage
+	if len(storage) != 2 || *storage[0].Want != (types.Hash{1}) || *storage[0].Got != (types.Hash{7}) ||
+		storage[1].Key != (types.Hash{2, 2}) || storage[1].Got != nil {
+		t.Fatalf("unexpected storage diff: %+v", storage)
+	}
+
+	if diff.InputSubstate[2].Status != AccountMissing || diff.InputSubstate[3].Status != AccountUnexpected {
+		t.Fatalf("unexpected account status: %+v", diff.InputSubstate[2:])
+	}
+}
+
+func TestDiff_TreatsNilAccountsAsMissing(t *testing.T) {
+	want := WorldState{
+		types.Address{1}: NewAccount(1, big.NewInt(1), nil),
+		types.Address{2}: nil,
+		types.Address{3}: nil,
+	}
+	got := WorldState{
+		types.Address{1}: nil,
+		types.Address{2}: NewAccount(2, big.NewInt(2), nil),
+		types.Address{4}: nil,
+	}
+
+	diffs := want.AccountDiffs(got)
+	if len(diffs) != 2 || diffs[0].Address != (types.Address{1}) || diffs[0].Status != AccountMissing ||
+		diffs[1].Address != (types.Address{2}) || diffs[1].Status != AccountUnexpected {
+		t.Fatalf("unexpected account diffs: %+v", diffs)
+	}
+
+	account := NewAccount(1, big.NewInt(1), nil)
+	account.Storage[types.Hash{1}] = types.Hash{2}
+	if fields := account.FieldDiffs(nil); len(fields) != 1 || fields[0] != (FieldDiff{Field: "Account", Want: "present", Got: "<nil>"}) {
+		t.Fatalf("unexpected field diffs: %+v", fields)
+	}
+	if storage := (*Account)(nil).StorageDiffs(account); len(storage) != 1 || storage[0].Want != nil || *storage[0].Got != (types.Hash{2}) {
+		t.Fatalf("unexpected storage diffs: %+v", storage)
+	}
+}
+
+func TestDiff_ReportsFieldAndLogDifferences(t *testing.T) {
+	want := newFingerprintTestSubstate()
+	got := newFingerprintTestSubstate()
+	got.Env.BlockHashes[2] = types.Hash{9}
+	got.Env.BaseFee = nil
+	got.Message.To = nil
+	got.Result.GasUsed = 13
+	got.Result.Logs[0].Topics = nil
+
+	diff := want.Diff(got)
+	wantEnv := []FieldDiff{
+		{Field: "BlockHashes[2]", Want: types.Hash{2}.String(), Got: types.Hash{9}.String()},
+		{Field: "BaseFee", Want: "5", Got: "<nil>"},
+	}
+	if len(diff.Env) != len(wantEnv) || diff.Env[0] != wantEnv[0] || diff.Env[1] != wantEnv[1] {
+		t.Fatalf("unexpected env diff: %+v", diff.Env)
+	}
+	if len(diff.Message) != 1 || diff.Message[0].Field != "To" || diff.Message[0].Got != "<missing>" {
+		t.Fatalf("unexpected message diff: %+v", diff.Message)
+	}
+	if len(diff.Result) != 1 || diff.Result[0].Field != "GasUsed" {
+		t.Fatalf("unexpected result diff: %+v", diff.Result)
+	}
+	if len(diff.Logs) != 1 || diff.Logs[0].Index != 0 || diff.Logs[0].Fields[0].Field != "Topics" {
+		t.Fatalf("unexpected log diff: %+v", diff.Logs)
+	}
+}
+
+func TestDiff_RendersOnlyDifferences(t *testing.T) {
+	want := newFingerprintTestSubstate()
+	got := newFingerprintTestSubstate()
+	got.InputSubstate[types.Address{1}].Balance = big.NewInt(42)
+	got.Message.Data = make([]byte, 100)
+
+	rendered := want.Diff(got).String()
+	lines := strings.Split(strings.TrimSpace(rendered), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected rendering\n%v", rendered)
+	}
+	for _, want := range []string{"Balance: want 1, got 42", "(100 bytes)"} {
+		if !strings.Contains(rendered, want) {
+			t.Fatalf("rendering does not contain %q\n%v", want, rendered)
+		}
+	}
+}
+
+func TestDiff_MarshalsToJSON(t *testing.T) {
+	want := newFingerprintTestSubstate()
+	got := newFingerprintTestSubstate()
+	got.OutputSubstate[types.Address{1}].Storage[types.Hash{1}] = types.Hash{2}
+
+	data, err := json.Marshal(want.Diff(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report map[string]any
+	if err = json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report["outputSubstate"] == nil {
+		t.Fatalf("unexpected report: %s", data)
+	}
+	if !strings.Contains(string(data), `"want":null`) {
+		t.Fatalf("missing slot is not reported as null: %s", data)
+	}
+}
+
+func TestSubstate_EqualReportsDifferencesOnly(t *testing.T) {
+	want := newFingerprintTestSubstate()
+	got := newFingerprintTestSubstate()
+	got.InputSubstate[types.Address{1}].Nonce = 100
+
+	err := want.Equal(got)
+	if err == nil {
+		t.Fatal("substates must not be equal")
+	}
+	if lines := strings.Split(strings.TrimSpace(err.Error()), "\n"); len(lines) != 3 {
+		t.Fatalf("unexpected error\n%v", err)
+	}
+}
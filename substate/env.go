@@ -3,6 +3,7 @@ package substate
 import (
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/0xsoniclabs/substate/types"
@@ -64,7 +65,8 @@ func (e *Env) Equal(y *Env) bool {
 		e.Timestamp == y.Timestamp &&
 		len(e.BlockHashes) == len(y.BlockHashes) &&
 		e.BaseFee.Cmp(y.BaseFee) == 0 &&
-		e.BlobBaseFee.Cmp(y.BlobBaseFee) == 0
+		e.BlobBaseFee.Cmp(y.BlobBaseFee) == 0 &&
+		(e.Random == y.Random || e.Random != nil && y.Random != nil && *e.Random == *y.Random)
 	if !equal {
 		return false
 	}
@@ -79,6 +81,19 @@ func (e *Env) Equal(y *Env) bool {
 	return true
 }
 
+// SortedBlockNumbers returns the numbers of blocks in e.BlockHashes in ascending order.
+func (e *Env) SortedBlockNumbers() []uint64 {
+	numbers := make([]uint64, 0, len(e.BlockHashes))
+	for number := range e.BlockHashes {
+		numbers = append(numbers, number)
+	}
+
+	sort.Slice(numbers, func(i, j int) bool {
+		return numbers[i] < numbers[j]
+	})
+	return numbers
+}
+
 func (e *Env) String() string {
 	var builder strings.Builder
 
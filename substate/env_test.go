@@ -138,3 +138,41 @@ func TestEnv_EqualBlobBaseFee(t *testing.T) {
 		t.Fatal("envs BlobBaseFee are same but equal returned false")
 	}
 }
+
+func TestEnv_EqualRandom(t *testing.T) {
+	env := &Env{
+		Random: &types.Hash{1},
+	}
+	comparedEnv := &Env{}
+
+	if env.Equal(comparedEnv) {
+		t.Fatal("envs Random are different but equal returned true")
+	}
+
+	comparedEnv.Random = &types.Hash{2}
+	if env.Equal(comparedEnv) {
+		t.Fatal("envs Random are different but equal returned true")
+	}
+
+	comparedEnv.Random = &types.Hash{1}
+	if !env.Equal(comparedEnv) {
+		t.Fatal("envs Random are same but equal returned false")
+	}
+}
+
+func TestEnv_SortedBlockNumbers(t *testing.T) {
+	env := &Env{BlockHashes: make(map[uint64]types.Hash)}
+	for i := uint64(100); i > 0; i-- {
+		env.BlockHashes[i*7%101] = types.Hash{byte(i)}
+	}
+
+	numbers := env.SortedBlockNumbers()
+	if len(numbers) != len(env.BlockHashes) {
+		t.Fatalf("incorrect number of block numbers\n got: %v\n want: %v", len(numbers), len(env.BlockHashes))
+	}
+	for i := 1; i < len(numbers); i++ {
+		if numbers[i-1] >= numbers[i] {
+			t.Fatalf("block numbers are not sorted: %v >= %v", numbers[i-1], numbers[i])
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package substate
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/0xsoniclabs/substate/types"
+	"github.com/0xsoniclabs/substate/types/hash"
+)
+
+// Fingerprints are Keccak256 digests over a canonical encoding of a value. The encoding
+// starts with a tag identifying the kind of value followed by its fields in declaration
+// order:
+//
+//   - integers are written as 8 bytes big endian,
+//   - byte slices and lists are prefixed by their length,
+//   - optional values (nil pointers) are prefixed by a presence byte,
+//   - maps are written sorted by key,
+//   - nested components are written as their fingerprint.
+//
+// Values with equal fields thus have equal fingerprints, regardless of map iteration order
+// and of the encoding they were stored with. Fields which are derived or only needed to
+// encode a value, such as Message.ProtobufTxType, are not part of the fingerprint.
+const (
+	accountFingerprintTag byte = iota + 1
+	worldStateFingerprintTag
+	envFingerprintTag
+	messageFingerprintTag
+	resultFingerprintTag
+	substateFingerprintTag
+)
+
+// Fingerprint returns the fingerprint of a; it covers the code hash instead of the code.
+func (a *Account) Fingerprint() types.Hash {
+	if a == nil {
+		return types.Hash{}
+	}
+
+	f := newFingerprinter(accountFingerprintTag)
+	f.uint64(a.Nonce)
+	f.bigInt(a.Balance)
+	f.hash(a.CodeHash())
+	f.length(len(a.Storage))
+	for _, key := range a.SortedStorageKeys() {
+		f.hash(key)
+		f.hash(a.Storage[key])
+	}
+	return f.sum()
+}
+
+// Fingerprint returns the fingerprint of ws over its addresses and account fingerprints.
+func (ws WorldState) Fingerprint() types.Hash {
+	f := newFingerprinter(worldStateFingerprintTag)
+	f.length(len(ws))
+	for _, addr := range ws.SortedAddresses() {
+		f.address(addr)
+		f.hash(ws[addr].Fingerprint())
+	}
+	return f.sum()
+}
+
+// Fingerprint returns the fingerprint of e with block hashes sorted by number.
+func (e *Env) Fingerprint() types.Hash {
+	if e == nil {
+		return types.Hash{}
+	}
+
+	f := newFingerprinter(envFingerprintTag)
+	f.address(e.Coinbase)
+	f.uint64(e.GasLimit)
+	f.uint64(e.Number)
+	f.uint64(e.Timestamp)
+	f.length(len(e.BlockHashes))
+	for _, number := range e.SortedBlockNumbers() {
+		f.uint64(number)
+		f.hash(e.BlockHashes[number])
+	}
+	f.bigInt(e.BaseFee)
+	f.bigInt(e.BlobBaseFee)
+	f.bigInt(e.Difficulty)
+	f.present(e.Random != nil)
+	if e.Random != nil {
+		f.hash(*e.Random)
+	}
+	return f.sum()
+}
+
+// Fingerprint returns the fingerprint of m.
+func (m *Message) Fingerprint() types.Hash {
+	if m == nil {
+		return types.Hash{}
+	}
+
+	f := newFingerprinter(messageFingerprintTag)
+	f.uint64(m.Nonce)
+	f.bool(m.CheckNonce)
+	f.bigInt(m.GasPrice)
+	f.uint64(m.Gas)
+	f.address(m.From)
+	f.present(m.To != nil)
+	if m.To != nil {
+		f.address(*m.To)
+	}
+	f.bigInt(m.Value)
+	f.bytes(m.Data)
+	f.length(len(m.AccessList))
+	for _, tuple := range m.AccessList {
+		f.address(tuple.Address)
+		f.length(len(tuple.StorageKeys))
+		for _, key := range tuple.StorageKeys {
+			f.hash(key)
+		}
+	}
+	f.bigInt(m.GasFeeCap)
+	f.bigInt(m.GasTipCap)
+	f.bigInt(m.BlobGasFeeCap)
+	f.length(len(m.BlobHashes))
+	for _, blobHash := range m.BlobHashes {
+		f.hash(blobHash)
+	}
+	return f.sum()
+}
+
+// Fingerprint returns the fingerprint of r; it covers the consensus fields of logs.
+func (r *Result) Fingerprint() types.Hash {
+	if r == nil {
+		return types.Hash{}
+	}
+
+	f := newFingerprinter(resultFingerprintTag)
+	f.uint64(r.Status)
+	f.write(r.Bloom[:])
+	f.length(len(r.Logs))
+	for _, log := range r.Logs {
+		f.address(log.Address)
+		f.length(len(log.Topics))
+		for _, topic := range log.Topics {
+			f.hash(topic)
+		}
+		f.bytes(log.Data)
+	}
+	f.address(r.ContractAddress)
+	f.uint64(r.GasUsed)
+	return f.sum()
+}
+
+// Fingerprint returns the fingerprint of s over the fingerprints of its components.
+// The block and transaction number are not covered, hence identical transactions
+// recorded at different positions have the same fingerprint.
+func (s *Substate) Fingerprint() types.Hash {
+	if s == nil {
+		return types.Hash{}
+	}
+
+	f := newFingerprinter(substateFingerprintTag)
+	f.hash(s.InputSubstate.Fingerprint())
+	f.hash(s.OutputSubstate.Fingerprint())
+	f.hash(s.Env.Fingerprint())
+	f.hash(s.Message.Fingerprint())
+	f.hash(s.Result.Fingerprint())
+	return f.sum()
+}
+
+// fingerprinter writes the canonical encoding of a value into a Keccak256 state.
+type fingerprinter struct {
+	state hash.KeccakState
+	buf   [8]byte
+}
+
+func newFingerprinter(tag byte) *fingerprinter {
+	f := &fingerprinter{state: hash.NewKeccakState()}
+	f.write([]byte{tag})
+	return f
+}
+
+func (f *fingerprinter) write(b []byte) {
+	// writing into a hash never fails
+	f.state.Write(b)
+}
+
+func (f *fingerprinter) uint64(v uint64) {
+	binary.BigEndian.PutUint64(f.buf[:], v)
+	f.write(f.buf[:])
+}
+
+func (f *fingerprinter) length(n int) {
+	f.uint64(uint64(n))
+}
+
+func (f *fingerprinter) bool(b bool) {
+	if b {
+		f.write([]byte{1})
+	} else {
+		f.write([]byte{0})
+	}
+}
+
+func (f *fingerprinter) present(ok bool) {
+	f.bool(ok)
+}
+
+func (f *fingerprinter) bytes(b []byte) {
+	f.length(len(b))
+	f.write(b)
+}
+
+func (f *fingerprinter) address(a types.Address) {
+	f.write(a[:])
+}
+
+func (f *fingerprinter) hash(h types.Hash) {
+	f.write(h[:])
+}
+
+// bigInt writes presence, sign and magnitude of b.
+func (f *fingerprinter) bigInt(b *big.Int) {
+	f.present(b != nil)
+	if b == nil {
+		return
+	}
+	f.write([]byte{byte(b.Sign() + 1)})
+	f.bytes(b.Bytes())
+}
+
+func (f *fingerprinter) sum() (h types.Hash) {
+	f.state.Read(h[:])
+	return h
+}
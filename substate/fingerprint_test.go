@@ -0,0 +1,121 @@
+package substate
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/0xsoniclabs/substate/types"
+)
+
+func newFingerprintTestSubstate() *Substate {
+	to := types.Address{2}
+	random := types.Hash{3}
+	ws := NewWorldState()
+	for i := 0; i < 50; i++ {
+		acc := NewAccount(uint64(i), big.NewInt(int64(i)), []byte{byte(i)})
+		for j := 0; j < 10; j++ {
+			acc.Storage[types.Hash{byte(i), byte(j)}] = types.Hash{byte(j)}
+		}
+		ws[types.Address{byte(i)}] = acc
+	}
+
+	env := NewEnv(types.Address{1}, big.NewInt(1), 2, 3, 4, big.NewInt(5), nil, map[uint64]types.Hash{1: {1}, 2: {2}, 3: {3}})
+	env.Random = &random
+	return &Substate{
+		InputSubstate:  ws,
+		OutputSubstate: NewWorldState().Add(types.Address{1}, 1, big.NewInt(1), nil),
+		Env:            env,
+		Message: &Message{
+			Nonce:      1,
+			CheckNonce: true,
+			GasPrice:   big.NewInt(1),
+			Gas:        2,
+			From:       types.Address{1},
+			To:         &to,
+			Value:      big.NewInt(3),
+			Data:       []byte{4},
+			AccessList: types.AccessList{{Address: types.Address{5}, StorageKeys: []types.Hash{{6}}}},
+			GasFeeCap:  big.NewInt(7),
+			GasTipCap:  big.NewInt(8),
+		},
+		Result: &Result{
+			Status:  1,
+			Logs:    []*types.Log{{Address: types.Address{9}, Topics: []types.Hash{{10}}, Data: []byte{11}}},
+			GasUsed: 12,
+		},
+		Block:       13,
+		Transaction: 14,
+	}
+}
+
+func TestFingerprint_IsIndependentOfMapOrder(t *testing.T) {
+	ss := newFingerprintTestSubstate()
+	want := ss.Fingerprint()
+
+	for i := 0; i < 10; i++ {
+		ws := NewWorldState()
+		for addr, acc := range ss.InputSubstate {
+			ws[addr] = acc.Copy()
+		}
+		blockHashes := make(map[uint64]types.Hash)
+		for number, hash := range ss.Env.BlockHashes {
+			blockHashes[number] = hash
+		}
+
+		cp := *ss
+		env := *ss.Env
+		env.BlockHashes = blockHashes
+		cp.Env = &env
+		cp.InputSubstate = ws
+		if got := cp.Fingerprint(); got != want {
+			t.Fatalf("fingerprint of copy differs\ngot: %v\nwant: %v", got, want)
+		}
+	}
+}
+
+func TestFingerprint_IgnoresPositionAndEncodingFields(t *testing.T) {
+	ss := newFingerprintTestSubstate()
+	want := ss.Fingerprint()
+
+	txType := int32(2)
+	ss.Block, ss.Transaction = 100, 200
+	ss.Message.ProtobufTxType = &txType
+	ss.Message.DataHash()
+	if got := ss.Fingerprint(); got != want {
+		t.Fatalf("fingerprint differs\ngot: %v\nwant: %v", got, want)
+	}
+}
+
+func TestFingerprint_ChangesWithContent(t *testing.T) {
+	changes := map[string]func(ss *Substate){
+		"storage":         func(ss *Substate) { ss.InputSubstate[types.Address{1}].Storage[types.Hash{1}] = types.Hash{1} },
+		"code":            func(ss *Substate) { ss.OutputSubstate[types.Address{1}].Code = []byte{1} },
+		"missing account": func(ss *Substate) { delete(ss.InputSubstate, types.Address{1}) },
+		"block hash":      func(ss *Substate) { ss.Env.BlockHashes[4] = types.Hash{4} },
+		"random":          func(ss *Substate) { ss.Env.Random = nil },
+		"blob base fee":   func(ss *Substate) { ss.Env.BlobBaseFee = big.NewInt(0) },
+		"to":              func(ss *Substate) { ss.Message.To = nil },
+		"value":           func(ss *Substate) { ss.Message.Value = big.NewInt(-3) },
+		"access list":     func(ss *Substate) { ss.Message.AccessList[0].StorageKeys = nil },
+		"log data":        func(ss *Substate) { ss.Result.Logs[0].Data = []byte{11, 0} },
+		"status":          func(ss *Substate) { ss.Result.Status = 0 },
+	}
+
+	want := newFingerprintTestSubstate().Fingerprint()
+	for name, change := range changes {
+		ss := newFingerprintTestSubstate()
+		change(ss)
+		if ss.Fingerprint() == want {
+			t.Errorf("fingerprint does not change with %v", name)
+		}
+	}
+}
+
+func TestFingerprint_ComponentsOfDifferentKindDiffer(t *testing.T) {
+	if (&Env{}).Fingerprint() == (&Result{}).Fingerprint() {
+		t.Fatal("empty env and result have the same fingerprint")
+	}
+	if (&Account{}).Fingerprint() == (WorldState{}).Fingerprint() {
+		t.Fatal("empty account and world state have the same fingerprint")
+	}
+}
@@ -45,24 +45,30 @@ func (s *Substate) Equal(y *Substate) (err error) {
 	msg := s.Message.Equal(y.Message)
 	res := s.Result.Equal(y.Result)
 
+	// report only the differences of unequal components
 	if !preState {
-		err = errors.Join(err, fmt.Errorf("preState is different\nwant: %v\n got: %v", s.InputSubstate.String(), y.InputSubstate.String()))
+		diff := &SubstateDiff{InputSubstate: s.InputSubstate.AccountDiffs(y.InputSubstate)}
+		err = errors.Join(err, fmt.Errorf("preState is different\n%v", diff))
 	}
 
 	if !postState {
-		err = errors.Join(err, fmt.Errorf("postState is different\nwant: %v\n got: %v", s.OutputSubstate.String(), y.OutputSubstate.String()))
+		diff := &SubstateDiff{OutputSubstate: s.OutputSubstate.AccountDiffs(y.OutputSubstate)}
+		err = errors.Join(err, fmt.Errorf("postState is different\n%v", diff))
 	}
 
 	if !env {
-		err = errors.Join(err, fmt.Errorf("env is different\nwant: %v\n got: %v", s.Env.String(), y.Env.String()))
+		diff := &SubstateDiff{Env: s.Env.FieldDiffs(y.Env)}
+		err = errors.Join(err, fmt.Errorf("env is different\n%v", diff))
 	}
 
 	if !msg {
-		err = errors.Join(err, fmt.Errorf("message is different\nwant: %v\n got: %v", s.Message.String(), y.Message.String()))
+		diff := &SubstateDiff{Message: s.Message.FieldDiffs(y.Message)}
+		err = errors.Join(err, fmt.Errorf("message is different\n%v", diff))
 	}
 
 	if !res {
-		err = errors.Join(err, fmt.Errorf("result is different\nwant: %v\n got: %v", s.Result.String(), y.Result.String()))
+		diff := &SubstateDiff{Result: s.Result.FieldDiffs(y.Result), Logs: s.Result.LogDiffs(y.Result)}
+		err = errors.Join(err, fmt.Errorf("result is different\n%v", diff))
 	}
 
 	return err
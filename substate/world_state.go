@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/0xsoniclabs/substate/types"
@@ -27,6 +28,19 @@ func (ws WorldState) Add(addr types.Address, nonce uint64, balance *big.Int, cod
 	return ws
 }
 
+// SortedAddresses returns the addresses of ws in ascending order.
+func (ws WorldState) SortedAddresses() []types.Address {
+	addresses := make([]types.Address, 0, len(ws))
+	for addr := range ws {
+		addresses = append(addresses, addr)
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Compare(addresses[j]) < 0
+	})
+	return addresses
+}
+
 // Merge y into ws. If values differs, values from y are saved.
 func (ws WorldState) Merge(y WorldState) {
 	for yAddr, yAcc := range y {
@@ -167,3 +167,20 @@ func TestWorl_Copy(t *testing.T) {
 		t.Fatalf("accounts values must be equal\ngot: %v\nwant: %v", cpy, acc)
 	}
 }
+
+func TestWorldState_SortedAddresses(t *testing.T) {
+	worldState := make(WorldState)
+	for i := 100; i > 0; i-- {
+		worldState.Add(types.Address{byte(i % 7), byte(i)}, 1, new(big.Int).SetUint64(1), nil)
+	}
+
+	addresses := worldState.SortedAddresses()
+	if len(addresses) != len(worldState) {
+		t.Fatalf("incorrect number of addresses\n got: %v\n want: %v", len(addresses), len(worldState))
+	}
+	for i := 1; i < len(addresses); i++ {
+		if addresses[i-1].Compare(addresses[i]) >= 0 {
+			t.Fatalf("addresses are not sorted: %v >= %v", addresses[i-1], addresses[i])
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"bytes"
 	"encoding/hex"
 )
 
@@ -15,6 +16,9 @@ func (a Address) String() string {
 
 func (a Address) Bytes() []byte { return a[:] }
 
+// Compare returns -1, 0 or +1 depending on whether a is less than, equal to or greater than a2.
+func (a Address) Compare(a2 Address) int { return bytes.Compare(a[:], a2[:]) }
+
 // HexToAddress returns Address with byte values of s.
 // If s is larger than len(h), s will be cropped from the left.
 func HexToAddress(s string) Address { return BytesToAddress(FromHex(s)) }
@@ -104,3 +104,12 @@ func TestAddress_UnmarshalText(t *testing.T) {
 		}
 	}
 }
+
+func TestAddress_Compare(t *testing.T) {
+	a1 := Address{1}
+	a2 := Address{1, 1}
+
+	if a1.Compare(a2) != -1 || a2.Compare(a1) != 1 || a1.Compare(a1) != 0 {
+		t.Fatal("incorrect comparing")
+	}
+}
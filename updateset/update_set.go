@@ -23,18 +23,9 @@ type UpdateSet struct {
 	DeletedAccounts []types.Address
 }
 
+// ToWorldStateRLP converts the world state of s into its RLP representation sorted by address.
 func (s UpdateSet) ToWorldStateRLP() rlp.WorldState {
-	a := rlp.WorldState{
-		Addresses: []types.Address{},
-		Accounts:  []*rlp.SubstateAccountRLP{},
-	}
-
-	for addr, acc := range s.WorldState {
-		a.Addresses = append(a.Addresses, addr)
-		a.Accounts = append(a.Accounts, rlp.NewRLPAccount(acc))
-	}
-
-	return a
+	return rlp.NewWorldState(s.WorldState)
 }
 
 func NewUpdateSetRLP(updateSet *UpdateSet, deletedAccounts []types.Address) UpdateSetRLP {